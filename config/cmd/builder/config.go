@@ -1,113 +1,472 @@
 package builder
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/postgres"
 	env "service-worker-sqs-postgres/dataproviders/utils"
+	"strings"
 )
 
+// regionPattern matches the names of the aws regions, like us-east-1 or us-gov-west-1.
+var regionPattern = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-\d+$`)
+
+// ConfigError lists every problem found loading the configuration, so they can be fixed at once.
+type ConfigError struct {
+	Problems []error
+	unread   map[string]bool
+}
+
+// Error returns the problems separated by semicolons.
+func (e *ConfigError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		messages = append(messages, problem.Error())
+	}
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(messages, "; "))
+}
+
+// add records err, a nil err is ignored.
+func (e *ConfigError) add(err error) {
+	if err != nil {
+		e.Problems = append(e.Problems, err)
+	}
+}
+
+// read records the err reading the env var name, the range of a var that couldn't be read isn't checked
+// since its problem is already reported.
+func (e *ConfigError) read(name string, err error) {
+	if err == nil {
+		return
+	}
+	if e.unread == nil {
+		e.unread = make(map[string]bool)
+	}
+	e.unread[name] = true
+	e.add(err)
+}
+
 // Configuration represents parameters of application.
 type Configuration struct {
 	Port                 int
+	ShutdownTimeout      int
 	ApplicationID        string
 	LogLevel             string
+	LogSampleInterval    int
+	LogSampleFirst       int
+	LogSampleThereafter  int
 	Region               string
 	AccessKey            string
 	SecretKey            string
+	AWSEndpoint          string
+	RoleARN              string
+	RoleExternalID       string
+	RoleSessionName      string
 	SQSUrl               string
 	SQSMaxMessages       int
 	SQSVisibilityTimeout int
+	SQSWaitTimeSeconds   int
+	SQSFIFO              bool
+	SQSContentDedup      bool
+	SQSAttributeNames    string
+	SQSMessageAttributes string
+	SQSWorkers           int
+	SQSBufferSize        int
+	SQSMaxInFlight       int
+	SQSMaxRetries        int
+	SQSDLQUrl            string
+	SQSBatchDeleteMs     int
+	SQSMalformedAction   string
+	SQSDeliveryMode      string
+	SQSCodec             string
+	SQSIdempotency       bool
+	SQSDryRun            bool
+	SQSDelayedRetry      bool
+	SQSAttemptHistory    int
+	SQSRateLimit         int
+	SQSRateBurst         int
+	SQSProcessTimeoutMs  int
+	SQSAdaptiveBatchMs   int
+	SQSSlowThresholdMs   int
+	SQSBatchInsert       bool
+	SQSDepthInterval     int
+	S3ClaimCheckBucket   string
+	RedisAddr            string
+	RedisPassword        string
+	RedisDedupTTL        int
+	OutboxQueueURL       string
+	OutboxPollIntervalMs int
+	OutboxMaxAttempts    int
 	DBPort               string
 	DBHost               string
 	DBName               string
 	DBUsername           string
 	DBPassword           string
+
+	DBMaxOpenConns           int
+	DBMaxIdleConns           int
+	DBConnMaxLifetimeSeconds int
+	DBConnMaxIdleTimeSeconds int
+	DBMaxRetries             int
+	DBAutoMigrate            bool
+	DBEventsTable            string
+	DBDriver                 string
+	DBSSLMode                string
+	DBSSLRootCert            string
+	DBSSLCert                string
+	DBSSLKey                 string
+	DBReplicaHosts           string
+	DBSlowQueryMs            int
+	DBRetentionHours         int
 }
 
-// LoadConfig get all the configuration variables for the implemented usecases.
+// LoadConfig get all the configuration variables for the implemented usecases. The missing, malformed
+// and out of range variables are all reported together in a *ConfigError.
 func LoadConfig() (*Configuration, error) {
+	problems := &ConfigError{}
+
 	applicationID, err := env.GetString("APPLICATION_ID")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("APPLICATION_ID", err)
 
 	port, err := env.GetInt("SERVER_PORT")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("SERVER_PORT", err)
 
 	loglevel, err := env.GetString("LOG_LEVEL")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("LOG_LEVEL", err)
 
-	access, err := env.GetString("AWS_ACCESS_KEY")
-	if err != nil {
-		return nil, err
-	}
+	shutdownTimeout, err := env.GetIntOrDefault("SHUTDOWN_TIMEOUT_SECONDS", 30)
+	problems.read("SHUTDOWN_TIMEOUT_SECONDS", err)
 
-	secret, err := env.GetString("AWS_SECRET_KEY")
-	if err != nil {
-		return nil, err
-	}
+	logSampleInterval, err := env.GetIntOrDefault("LOG_SAMPLING_INTERVAL_SECONDS", 60)
+	problems.read("LOG_SAMPLING_INTERVAL_SECONDS", err)
+
+	logSampleFirst, err := env.GetIntOrDefault("LOG_SAMPLING_FIRST", 10)
+	problems.read("LOG_SAMPLING_FIRST", err)
+
+	logSampleThereafter, err := env.GetIntOrDefault("LOG_SAMPLING_THEREAFTER", 100)
+	problems.read("LOG_SAMPLING_THEREAFTER", err)
+
+	access := env.GetStringOrDefault("AWS_ACCESS_KEY", "")
+
+	secret := env.GetStringOrDefault("AWS_SECRET_KEY", "")
 
 	region, err := env.GetString("AWS_REGION")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("AWS_REGION", err)
+
+	awsEndpoint := env.GetStringOrDefault("AWS_ENDPOINT_URL", "")
+
+	roleARN := env.GetStringOrDefault("AWS_ROLE_ARN", "")
+
+	roleExternalID := env.GetStringOrDefault("AWS_ROLE_EXTERNAL_ID", "")
+
+	roleSessionName := env.GetStringOrDefault("AWS_ROLE_SESSION_NAME", applicationID)
 
 	sqsUrl, err := env.GetString("AWS_SQS_URL")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("AWS_SQS_URL", err)
 
 	sqsMaxMessages, err := env.GetInt("AWS_SQS_MAX_MESSAGES")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("AWS_SQS_MAX_MESSAGES", err)
 
 	sqsVisibilityTimeout, err := env.GetInt("AWS_SQS_VISIBILITY_TIMEOUT")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("AWS_SQS_VISIBILITY_TIMEOUT", err)
+
+	sqsWaitTimeSeconds, err := env.GetIntOrDefault("AWS_SQS_WAIT_TIME_SECONDS", awssqs.DefaultWaitTimeSeconds)
+	problems.read("AWS_SQS_WAIT_TIME_SECONDS", err)
+
+	sqsFIFO, err := env.GetBoolOrDefault("AWS_SQS_FIFO", false)
+	problems.read("AWS_SQS_FIFO", err)
+
+	sqsContentDedup, err := env.GetBoolOrDefault("AWS_SQS_CONTENT_DEDUPLICATION", false)
+	problems.read("AWS_SQS_CONTENT_DEDUPLICATION", err)
+
+	sqsAttributeNames := env.GetStringOrDefault("AWS_SQS_ATTRIBUTE_NAMES", "All")
+	sqsMessageAttributes := env.GetStringOrDefault("AWS_SQS_MESSAGE_ATTRIBUTE_NAMES", "All")
+
+	sqsWorkers, err := env.GetIntOrDefault("AWS_SQS_WORKERS", 1)
+	problems.read("AWS_SQS_WORKERS", err)
+
+	sqsBufferSize, err := env.GetIntOrDefault("AWS_SQS_BUFFER_SIZE", sqsMaxMessages)
+	problems.read("AWS_SQS_BUFFER_SIZE", err)
+
+	sqsMaxInFlight, err := env.GetIntOrDefault("AWS_SQS_MAX_IN_FLIGHT", 0)
+	problems.read("AWS_SQS_MAX_IN_FLIGHT", err)
+
+	sqsMaxRetries, err := env.GetIntOrDefault("AWS_SQS_MAX_RETRIES", 0)
+	problems.read("AWS_SQS_MAX_RETRIES", err)
+
+	sqsDLQUrl := env.GetStringOrDefault("AWS_SQS_DLQ_URL", "")
+
+	sqsBatchDeleteMs, err := env.GetIntOrDefault("AWS_SQS_BATCH_DELETE_MS", 0)
+	problems.read("AWS_SQS_BATCH_DELETE_MS", err)
+
+	sqsMalformedAction := env.GetStringOrDefault("AWS_SQS_MALFORMED_ACTION", "leave")
+
+	sqsDeliveryMode := env.GetStringOrDefault("AWS_SQS_DELIVERY_MODE", "at-least-once")
+
+	sqsCodec := env.GetStringOrDefault("AWS_SQS_CODEC", "json")
+
+	sqsIdempotency, err := env.GetBoolOrDefault("AWS_SQS_IDEMPOTENCY", false)
+	problems.read("AWS_SQS_IDEMPOTENCY", err)
+
+	sqsDryRun, err := env.GetBoolOrDefault("AWS_SQS_DRY_RUN", false)
+	problems.read("AWS_SQS_DRY_RUN", err)
+
+	sqsDelayedRetry, err := env.GetBoolOrDefault("AWS_SQS_DELAYED_RETRY", false)
+	problems.read("AWS_SQS_DELAYED_RETRY", err)
+
+	sqsAttemptHistory, err := env.GetIntOrDefault("AWS_SQS_ATTEMPT_HISTORY", 0)
+	problems.read("AWS_SQS_ATTEMPT_HISTORY", err)
+
+	sqsRateLimit, err := env.GetIntOrDefault("AWS_SQS_RATE_LIMIT", 0)
+	problems.read("AWS_SQS_RATE_LIMIT", err)
+
+	sqsRateBurst, err := env.GetIntOrDefault("AWS_SQS_RATE_BURST", 1)
+	problems.read("AWS_SQS_RATE_BURST", err)
+
+	sqsProcessTimeoutMs, err := env.GetIntOrDefault("AWS_SQS_PROCESS_TIMEOUT_MS", 0)
+	problems.read("AWS_SQS_PROCESS_TIMEOUT_MS", err)
+
+	sqsSlowThresholdMs, err := env.GetIntOrDefault("AWS_SQS_SLOW_THRESHOLD_MS", 0)
+	problems.read("AWS_SQS_SLOW_THRESHOLD_MS", err)
+
+	sqsAdaptiveBatchMs, err := env.GetIntOrDefault("AWS_SQS_ADAPTIVE_BATCH_TARGET_MS", 0)
+	problems.read("AWS_SQS_ADAPTIVE_BATCH_TARGET_MS", err)
+
+	sqsBatchInsert, err := env.GetBoolOrDefault("AWS_SQS_BATCH_INSERT", false)
+	problems.read("AWS_SQS_BATCH_INSERT", err)
+
+	sqsDepthIntervalSeconds, err := env.GetIntOrDefault("AWS_SQS_DEPTH_INTERVAL_SECONDS", 0)
+	problems.read("AWS_SQS_DEPTH_INTERVAL_SECONDS", err)
+
+	s3ClaimCheckBucket := env.GetStringOrDefault("AWS_S3_CLAIM_CHECK_BUCKET", "")
+
+	redisAddr := env.GetStringOrDefault("REDIS_ADDR", "")
+
+	redisPassword := env.GetStringOrDefault("REDIS_PASSWORD", "")
+
+	redisDedupTTLSeconds, err := env.GetIntOrDefault("REDIS_DEDUP_TTL_SECONDS", 86400)
+	problems.read("REDIS_DEDUP_TTL_SECONDS", err)
+
+	outboxQueueURL := env.GetStringOrDefault("OUTBOX_QUEUE_URL", "")
+
+	outboxPollIntervalMs, err := env.GetIntOrDefault("OUTBOX_POLL_INTERVAL_MS", 1000)
+	problems.read("OUTBOX_POLL_INTERVAL_MS", err)
+
+	outboxMaxAttempts, err := env.GetIntOrDefault("OUTBOX_MAX_ATTEMPTS", 0)
+	problems.read("OUTBOX_MAX_ATTEMPTS", err)
 
 	dbPort, err := env.GetString("DB_PORT")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("DB_PORT", err)
 
 	dbHost, err := env.GetString("DB_HOST")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("DB_HOST", err)
 
 	dbName, err := env.GetString("DB_NAME")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("DB_NAME", err)
 
 	dbUsername, err := env.GetString("DB_USERNAME")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("DB_USERNAME", err)
 
 	dbPassword, err := env.GetString("DB_PASSWORD")
-	if err != nil {
-		return nil, err
-	}
+	problems.read("DB_PASSWORD", err)
+
+	pool := postgres.DefaultConfig()
+
+	dbMaxOpenConns, err := env.GetIntOrDefault("DB_MAX_OPEN_CONNS", pool.MaxOpenConns)
+	problems.read("DB_MAX_OPEN_CONNS", err)
+
+	dbMaxIdleConns, err := env.GetIntOrDefault("DB_MAX_IDLE_CONNS", pool.MaxIdleConns)
+	problems.read("DB_MAX_IDLE_CONNS", err)
+
+	dbConnMaxLifetime, err := env.GetIntOrDefault("DB_CONN_MAX_LIFETIME_SECONDS", int(pool.ConnMaxLifetime.Seconds()))
+	problems.read("DB_CONN_MAX_LIFETIME_SECONDS", err)
+
+	dbConnMaxIdleTime, err := env.GetIntOrDefault("DB_CONN_MAX_IDLE_TIME_SECONDS", int(pool.ConnMaxIdleTime.Seconds()))
+	problems.read("DB_CONN_MAX_IDLE_TIME_SECONDS", err)
+
+	dbMaxRetries, err := env.GetIntOrDefault("DB_MAX_RETRIES", 3)
+	problems.read("DB_MAX_RETRIES", err)
+
+	dbAutoMigrate, err := env.GetBoolOrDefault("DB_AUTO_MIGRATE", true)
+	problems.read("DB_AUTO_MIGRATE", err)
+
+	dbEventsTable := env.GetStringOrDefault("DB_EVENTS_TABLE", pool.EventsTable)
+
+	dbDriver := env.GetStringOrDefault("DB_DRIVER", pool.Driver)
+
+	dbSSLMode := env.GetStringOrDefault("DB_SSL_MODE", pool.SSLMode)
+
+	dbSSLRootCert := env.GetStringOrDefault("DB_SSL_ROOT_CERT", "")
+
+	dbSSLCert := env.GetStringOrDefault("DB_SSL_CERT", "")
+
+	dbSSLKey := env.GetStringOrDefault("DB_SSL_KEY", "")
 
-	return &Configuration{
+	dbReplicaHosts := env.GetStringOrDefault("DB_REPLICA_HOSTS", "")
+
+	dbSlowQueryMs, err := env.GetIntOrDefault("DB_SLOW_QUERY_MS", int(pool.SlowQueryThreshold.Milliseconds()))
+	problems.read("DB_SLOW_QUERY_MS", err)
+
+	dbRetentionHours, err := env.GetIntOrDefault("DB_RETENTION_HOURS", 0)
+	problems.read("DB_RETENTION_HOURS", err)
+
+	config := &Configuration{
 		Port:                 port,
+		ShutdownTimeout:      shutdownTimeout,
 		ApplicationID:        applicationID,
 		LogLevel:             loglevel,
+		LogSampleInterval:    logSampleInterval,
+		LogSampleFirst:       logSampleFirst,
+		LogSampleThereafter:  logSampleThereafter,
 		AccessKey:            access,
 		SecretKey:            secret,
 		Region:               region,
+		AWSEndpoint:          awsEndpoint,
+		RoleARN:              roleARN,
+		RoleExternalID:       roleExternalID,
+		RoleSessionName:      roleSessionName,
 		SQSUrl:               sqsUrl,
 		SQSMaxMessages:       sqsMaxMessages,
 		SQSVisibilityTimeout: sqsVisibilityTimeout,
+		SQSWaitTimeSeconds:   sqsWaitTimeSeconds,
+		SQSFIFO:              sqsFIFO,
+		SQSAttributeNames:    sqsAttributeNames,
+		SQSMessageAttributes: sqsMessageAttributes,
+		SQSContentDedup:      sqsContentDedup,
+		SQSWorkers:           sqsWorkers,
+		SQSBufferSize:        sqsBufferSize,
+		SQSMaxInFlight:       sqsMaxInFlight,
+		SQSMaxRetries:        sqsMaxRetries,
+		SQSDLQUrl:            sqsDLQUrl,
+		SQSBatchDeleteMs:     sqsBatchDeleteMs,
+		SQSMalformedAction:   sqsMalformedAction,
+		SQSDeliveryMode:      sqsDeliveryMode,
+		SQSCodec:             sqsCodec,
+		SQSIdempotency:       sqsIdempotency,
+		SQSDryRun:            sqsDryRun,
+		SQSDelayedRetry:      sqsDelayedRetry,
+		SQSAttemptHistory:    sqsAttemptHistory,
+		SQSRateLimit:         sqsRateLimit,
+		SQSRateBurst:         sqsRateBurst,
+		SQSProcessTimeoutMs:  sqsProcessTimeoutMs,
+		SQSAdaptiveBatchMs:   sqsAdaptiveBatchMs,
+		SQSSlowThresholdMs:   sqsSlowThresholdMs,
+		SQSBatchInsert:       sqsBatchInsert,
+		SQSDepthInterval:     sqsDepthIntervalSeconds,
+		S3ClaimCheckBucket:   s3ClaimCheckBucket,
+		RedisAddr:            redisAddr,
+		RedisPassword:        redisPassword,
+		RedisDedupTTL:        redisDedupTTLSeconds,
+		OutboxQueueURL:       outboxQueueURL,
+		OutboxPollIntervalMs: outboxPollIntervalMs,
+		OutboxMaxAttempts:    outboxMaxAttempts,
 		DBPort:               dbPort,
 		DBHost:               dbHost,
 		DBName:               dbName,
 		DBUsername:           dbUsername,
 		DBPassword:           dbPassword,
-	}, nil
+
+		DBMaxOpenConns:           dbMaxOpenConns,
+		DBMaxIdleConns:           dbMaxIdleConns,
+		DBConnMaxLifetimeSeconds: dbConnMaxLifetime,
+		DBConnMaxIdleTimeSeconds: dbConnMaxIdleTime,
+		DBMaxRetries:             dbMaxRetries,
+		DBAutoMigrate:            dbAutoMigrate,
+		DBEventsTable:            dbEventsTable,
+		DBDriver:                 dbDriver,
+		DBSSLMode:                dbSSLMode,
+		DBSSLRootCert:            dbSSLRootCert,
+		DBSSLCert:                dbSSLCert,
+		DBSSLKey:                 dbSSLKey,
+		DBReplicaHosts:           dbReplicaHosts,
+		DBSlowQueryMs:            dbSlowQueryMs,
+		DBRetentionHours:         dbRetentionHours,
+	}
+	var invalid *ConfigError
+	if err := config.validate(problems.unread); errors.As(err, &invalid) {
+		problems.Problems = append(problems.Problems, invalid.Problems...)
+	}
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+
+	return config, nil
+}
+
+// Validate checks the values of the configuration, every value out of range is reported in a *ConfigError.
+func (c *Configuration) Validate() error {
+	return c.validate(nil)
+}
+
+// validate checks the values of the configuration but the ones of the unread env vars.
+func (c *Configuration) validate(unread map[string]bool) error {
+	problems := &ConfigError{}
+	checked := func(names ...string) bool {
+		for _, name := range names {
+			if unread[name] {
+				return false
+			}
+		}
+		return true
+	}
+	if checked("SERVER_PORT") && (c.Port < 1 || c.Port > 65535) {
+		problems.add(fmt.Errorf("env var SERVER_PORT must be between 1 and 65535, got %d", c.Port))
+	}
+	if checked("SHUTDOWN_TIMEOUT_SECONDS") && c.ShutdownTimeout < 1 {
+		problems.add(fmt.Errorf("env var SHUTDOWN_TIMEOUT_SECONDS must be greater than 0, got %d", c.ShutdownTimeout))
+	}
+	if checked("AWS_REGION") && !regionPattern.MatchString(c.Region) {
+		problems.add(fmt.Errorf("env var AWS_REGION must be an aws region like us-east-1, got %q", c.Region))
+	}
+	if checked("LOG_SAMPLING_FIRST", "LOG_SAMPLING_THEREAFTER", "LOG_SAMPLING_INTERVAL_SECONDS") && (c.LogSampleFirst < 0 || c.LogSampleThereafter < 0 || (c.LogSampleFirst > 0 && c.LogSampleInterval < 1)) {
+		problems.add(fmt.Errorf("env vars LOG_SAMPLING_FIRST and LOG_SAMPLING_THEREAFTER must not be negative and LOG_SAMPLING_INTERVAL_SECONDS must be greater than 0, got %d, %d and %d", c.LogSampleFirst, c.LogSampleThereafter, c.LogSampleInterval))
+	}
+	if checked("AWS_SQS_URL") && c.SQSUrl == "" {
+		problems.add(errors.New("env var AWS_SQS_URL must not be empty"))
+	}
+	if checked("AWS_SQS_MAX_MESSAGES") && (c.SQSMaxMessages < 1 || c.SQSMaxMessages > awssqs.MaxReceiveMessages) {
+		problems.add(fmt.Errorf("env var AWS_SQS_MAX_MESSAGES must be between 1 and %d, got %d", awssqs.MaxReceiveMessages, c.SQSMaxMessages))
+	}
+	if checked("AWS_SQS_VISIBILITY_TIMEOUT") && (c.SQSVisibilityTimeout < 0 || c.SQSVisibilityTimeout > awssqs.MaxVisibilityTimeout) {
+		problems.add(fmt.Errorf("env var AWS_SQS_VISIBILITY_TIMEOUT must be between 0 and %d, got %d", awssqs.MaxVisibilityTimeout, c.SQSVisibilityTimeout))
+	}
+	if checked("AWS_SQS_WAIT_TIME_SECONDS") && (c.SQSWaitTimeSeconds < 0 || c.SQSWaitTimeSeconds > awssqs.MaxWaitTimeSeconds) {
+		problems.add(fmt.Errorf("env var AWS_SQS_WAIT_TIME_SECONDS must be between 0 and %d, got %d", awssqs.MaxWaitTimeSeconds, c.SQSWaitTimeSeconds))
+	}
+	if checked("AWS_SQS_WORKERS") && c.SQSWorkers < 1 {
+		problems.add(fmt.Errorf("env var AWS_SQS_WORKERS must be greater than 0, got %d", c.SQSWorkers))
+	}
+	if checked("AWS_SQS_MAX_RETRIES") && c.SQSMaxRetries < 0 {
+		problems.add(fmt.Errorf("env var AWS_SQS_MAX_RETRIES must not be negative, got %d", c.SQSMaxRetries))
+	}
+	if checked("OUTBOX_POLL_INTERVAL_MS") && c.OutboxPollIntervalMs < 1 {
+		problems.add(fmt.Errorf("env var OUTBOX_POLL_INTERVAL_MS must be greater than 0, got %d", c.OutboxPollIntervalMs))
+	}
+	if checked("OUTBOX_MAX_ATTEMPTS") && c.OutboxMaxAttempts < 0 {
+		problems.add(fmt.Errorf("env var OUTBOX_MAX_ATTEMPTS must not be negative, got %d", c.OutboxMaxAttempts))
+	}
+	if checked("DB_MAX_OPEN_CONNS") && c.DBMaxOpenConns < 1 {
+		problems.add(fmt.Errorf("env var DB_MAX_OPEN_CONNS must be greater than 0, got %d", c.DBMaxOpenConns))
+	}
+	if checked("DB_MAX_IDLE_CONNS", "DB_MAX_OPEN_CONNS") && (c.DBMaxIdleConns < 0 || c.DBMaxIdleConns > c.DBMaxOpenConns) {
+		problems.add(fmt.Errorf("env var DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS, got %d", c.DBMaxIdleConns))
+	}
+	if checked("DB_CONN_MAX_LIFETIME_SECONDS", "DB_CONN_MAX_IDLE_TIME_SECONDS") && (c.DBConnMaxLifetimeSeconds < 0 || c.DBConnMaxIdleTimeSeconds < 0) {
+		problems.add(fmt.Errorf("env vars DB_CONN_MAX_LIFETIME_SECONDS and DB_CONN_MAX_IDLE_TIME_SECONDS must not be negative, got %d and %d", c.DBConnMaxLifetimeSeconds, c.DBConnMaxIdleTimeSeconds))
+	}
+	if checked("DB_MAX_RETRIES") && c.DBMaxRetries < 0 {
+		problems.add(fmt.Errorf("env var DB_MAX_RETRIES must not be negative, got %d", c.DBMaxRetries))
+	}
+	if checked("AWS_SQS_ATTEMPT_HISTORY") && c.SQSAttemptHistory < 0 {
+		problems.add(fmt.Errorf("env var AWS_SQS_ATTEMPT_HISTORY must not be negative, got %d", c.SQSAttemptHistory))
+	}
+	if checked("DB_RETENTION_HOURS") && c.DBRetentionHours < 0 {
+		problems.add(fmt.Errorf("env var DB_RETENTION_HOURS must not be negative, got %d", c.DBRetentionHours))
+	}
+	if len(problems.Problems) > 0 {
+		return problems
+	}
+	return nil
 }
@@ -1,26 +1,128 @@
 package builder
 
 import (
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awss3"
 	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/codec"
 	"service-worker-sqs-postgres/dataproviders/consumer"
-	repository "service-worker-sqs-postgres/dataproviders/postgres/repository/events"
+	"service-worker-sqs-postgres/dataproviders/logging"
+	"service-worker-sqs-postgres/dataproviders/redis"
+	"strings"
+	"time"
 )
 
+// validateTimeout bounds the check at startup that the queues exist.
+const validateTimeout = 10 * time.Second
+
+// splitNames returns the names of a comma separated list, the blank ones are skipped.
+func splitNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // NewSQS define all usecases to instantiate SQS.
-func NewSQS(logger *zap.SugaredLogger, config *Configuration, session *session.Session, repo repository.IEventRepository) (domain.Source, error) {
-	sqs, err := awssqs.NewSQSClient(session, config.SQSUrl, config.SQSMaxMessages, config.SQSVisibilityTimeout)
-	if err != nil {
-		return nil, fmt.Errorf("error awssqs.NewSQSClient: %w", err)
+func NewSQS(logger *zap.SugaredLogger, config *Configuration, session *session.Session, repo consumer.EventStore, m consumer.Metrics) (domain.Source, error) {
+	var sqsOpts []awssqs.Option
+	if config.SQSFIFO {
+		sqsOpts = append(sqsOpts, awssqs.WithFIFO(config.SQSContentDedup))
+	}
+	if names := splitNames(config.SQSAttributeNames); len(names) > 0 {
+		sqsOpts = append(sqsOpts, awssqs.WithAttributeNames(names...))
+	}
+	if names := splitNames(config.SQSMessageAttributes); len(names) > 0 {
+		sqsOpts = append(sqsOpts, awssqs.WithMessageAttributeNames(names...))
+	}
+	var clients []awssqs.Client
+	for _, url := range strings.Split(config.SQSUrl, ",") {
+		sqs, err := awssqs.NewSQSClient(session, strings.TrimSpace(url), config.SQSMaxMessages, config.SQSVisibilityTimeout, config.SQSWaitTimeSeconds, sqsOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("error awssqs.NewSQSClient: %w", err)
+		}
+		clients = append(clients, sqs)
+	}
+
+	opts := []consumer.Option{
+		consumer.WithWorkers(config.SQSWorkers),
+		consumer.WithBufferSize(config.SQSBufferSize),
+		consumer.WithMaxRetries(config.SQSMaxRetries),
+		consumer.WithBatchDelete(time.Duration(config.SQSBatchDeleteMs) * time.Millisecond),
+		consumer.WithMalformedAction(consumer.MalformedAction(config.SQSMalformedAction)),
+		consumer.WithDeliveryMode(consumer.DeliveryMode(config.SQSDeliveryMode)),
+		consumer.WithDryRun(config.SQSDryRun),
+		consumer.WithLogSampling(time.Duration(config.LogSampleInterval)*time.Second, config.LogSampleFirst, config.LogSampleThereafter),
+		consumer.WithMetrics(m),
+		consumer.WithRateLimit(config.SQSRateLimit, config.SQSRateBurst),
+		consumer.WithProcessTimeout(time.Duration(config.SQSProcessTimeoutMs) * time.Millisecond),
+		consumer.WithSlowThreshold(time.Duration(config.SQSSlowThresholdMs) * time.Millisecond),
+		consumer.WithAdaptiveBatch(time.Duration(config.SQSAdaptiveBatchMs) * time.Millisecond),
+		consumer.WithRetention(time.Duration(config.DBRetentionHours) * time.Hour),
+		consumer.WithDepthInterval(time.Duration(config.SQSDepthInterval) * time.Second),
+		consumer.WithTracer(otel.Tracer("service-worker-sqs-postgres/consumer")),
+	}
+	switch config.SQSCodec {
+	case "json":
+	case "msgpack":
+		opts = append(opts, consumer.WithCodec(codec.NewMsgpack()))
+	default:
+		return nil, fmt.Errorf("unknown codec %q, protobuf requires consumer.WithCodec with its message type", config.SQSCodec)
+	}
+	if config.SQSMaxInFlight > 0 {
+		opts = append(opts, consumer.WithMaxInFlight(config.SQSMaxInFlight))
+	}
+	if config.SQSIdempotency {
+		opts = append(opts, consumer.WithIdempotency())
+	}
+	if config.SQSDelayedRetry {
+		opts = append(opts, consumer.WithDelayedRetry())
+	}
+	if config.SQSAttemptHistory > 0 {
+		opts = append(opts, consumer.WithAttemptHistory(config.SQSAttemptHistory))
+	}
+	if config.SQSBatchInsert {
+		opts = append(opts, consumer.WithBatchInsert())
+	}
+	if config.S3ClaimCheckBucket != "" {
+		store, err := awss3.NewS3Store(session, config.S3ClaimCheckBucket)
+		if err != nil {
+			return nil, fmt.Errorf("error awss3.NewS3Store: %w", err)
+		}
+		opts = append(opts, consumer.WithClaimCheck(store))
+	}
+	if config.RedisAddr != "" {
+		deduper, err := redis.NewDeduper(config.RedisAddr, config.RedisPassword, time.Duration(config.RedisDedupTTL)*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("error redis.NewDeduper: %w", err)
+		}
+		opts = append(opts, consumer.WithDeduper(deduper))
+	}
+	if config.SQSDLQUrl != "" {
+		dlq, err := awssqs.NewSQSClient(session, config.SQSDLQUrl, config.SQSMaxMessages, config.SQSVisibilityTimeout, config.SQSWaitTimeSeconds, sqsOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("error awssqs.NewSQSClient: %w", err)
+		}
+		opts = append(opts, consumer.WithDLQ(dlq))
 	}
 
-	source, err := consumer.New(sqs, logger, config.SQSMaxMessages, repo)
+	source, err := consumer.New(clients, logging.NewZap(logger), config.SQSMaxMessages, repo, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("error consumer.New: %w", err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+	defer cancel()
+	if err := source.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("error consumer.Validate: %w", err)
+	}
 
 	return source, nil
 }
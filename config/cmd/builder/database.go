@@ -1,13 +1,55 @@
 package builder
 
 import (
+	"go.uber.org/zap"
+	"service-worker-sqs-postgres/dataproviders/logging"
 	"service-worker-sqs-postgres/dataproviders/postgres"
+	"strings"
+	"time"
 )
 
-// NewDB defines all configurations to instantiate a postgres client.
-func NewDB(config *Configuration) (*postgres.ClientDB, error) {
-	db := postgres.NewDBClient(config.DBHost, config.DBUsername, config.DBPassword, config.DBName, config.DBPort)
-	err := db.Open()
+// NewDB defines all configurations to instantiate a postgres client, the schema is migrated when
+// the auto migration is enabled.
+func NewDB(logger *zap.SugaredLogger, config *Configuration) (*postgres.ClientDB, error) {
+	var replicas []string
+	if config.DBReplicaHosts != "" {
+		replicas = strings.Split(config.DBReplicaHosts, ",")
+	}
+	db, err := postgres.NewDBClient(config.DBHost, config.DBUsername, config.DBPassword, config.DBName, config.DBPort, postgres.Config{
+		Driver:          config.DBDriver,
+		SSLMode:         config.DBSSLMode,
+		SSLRootCert:     config.DBSSLRootCert,
+		SSLCert:         config.DBSSLCert,
+		SSLKey:          config.DBSSLKey,
+		MaxOpenConns:    config.DBMaxOpenConns,
+		MaxIdleConns:    config.DBMaxIdleConns,
+		ConnMaxLifetime: time.Duration(config.DBConnMaxLifetimeSeconds) * time.Second,
+		ConnMaxIdleTime: time.Duration(config.DBConnMaxIdleTimeSeconds) * time.Second,
+		EventsTable:     config.DBEventsTable,
+		Replicas:        replicas,
 
-	return db, err
+		Logger:             logging.NewZap(logger),
+		SlowQueryThreshold: time.Duration(config.DBSlowQueryMs) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Open(); err != nil {
+		return nil, err
+	}
+
+	if config.DBAutoMigrate {
+		changes, err := db.PendingMigrations()
+		if err != nil {
+			return nil, err
+		}
+		for _, change := range changes {
+			logger.Infof("Migrating postgres: %s", change)
+		}
+		if err = db.Migrate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return db, nil
 }
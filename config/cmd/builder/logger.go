@@ -4,19 +4,35 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"log"
+	env "service-worker-sqs-postgres/dataproviders/utils"
 )
 
-// NewLogger defines all configurations to instantiate a log.
+// NewLogger defines all configurations to instantiate a log. LOG_LEVEL sets the min level logged, by default
+// INFO, and LOG_FORMAT the encoding, json by default or console for reading the logs locally. They're read
+// here rather than in LoadConfig since the logger reports the configuration errors.
 func NewLogger() *zap.SugaredLogger {
+	level, err := zapcore.ParseLevel(env.GetStringOrDefault("LOG_LEVEL", "INFO"))
+	if err != nil {
+		log.Fatalf("Error creating logger: %v", err)
+	}
+	format := env.GetStringOrDefault("LOG_FORMAT", "json")
+	if format != "json" && format != "console" {
+		log.Fatalf("Error creating logger: unknown log format %q, it must be json or console", format)
+	}
+
 	config := zap.NewProductionConfig()
-	config.Encoding = "console"
+	config.Level = zap.NewAtomicLevelAt(level)
+	config.Encoding = format
 	config.DisableCaller = true
 	config.DisableStacktrace = true
 	config.EncoderConfig.TimeKey = "time"
 	config.EncoderConfig.LevelKey = "level"
 	config.EncoderConfig.MessageKey = "msg"
 	config.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	if format == "console" {
+		config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
 	config.EncoderConfig.ConsoleSeparator = "  "
 
 	logger, err := config.Build()
@@ -0,0 +1,10 @@
+package builder
+
+import (
+	"service-worker-sqs-postgres/dataproviders/metrics"
+)
+
+// NewMetrics defines the metrics registry exposed by the server and fed by the consumer.
+func NewMetrics() *metrics.Prometheus {
+	return metrics.NewPrometheus()
+}
@@ -0,0 +1,35 @@
+package builder
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"go.uber.org/zap"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/logging"
+	"service-worker-sqs-postgres/dataproviders/outbox"
+	"strings"
+	"time"
+)
+
+// NewOutboxRelay defines the relay publishing the outbox to its queue, it's nil when no queue is configured.
+func NewOutboxRelay(logger *zap.SugaredLogger, config *Configuration, session *session.Session, store outbox.Store) (*outbox.Relay, error) {
+	if config.OutboxQueueURL == "" {
+		return nil, nil
+	}
+	var opts []awssqs.Option
+	if strings.HasSuffix(config.OutboxQueueURL, ".fifo") {
+		opts = append(opts, awssqs.WithFIFO(false))
+	}
+	sender, err := awssqs.NewSQSClient(session, config.OutboxQueueURL, 1, 0, 0, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error awssqs.NewSQSClient: %w", err)
+	}
+
+	relay, err := outbox.NewRelay(store, sender, logging.NewZap(logger),
+		outbox.WithInterval(time.Duration(config.OutboxPollIntervalMs)*time.Millisecond),
+		outbox.WithMaxAttempts(config.OutboxMaxAttempts))
+	if err != nil {
+		return nil, fmt.Errorf("error outbox.NewRelay: %w", err)
+	}
+	return relay, nil
+}
@@ -1,23 +1,24 @@
 package builder
 
 import (
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
 )
 
 // NewSession define all configuration to instantiate a session aws.
+// Without access key the credentials are resolved by the default chain of the sdk.
 func NewSession(config *Configuration) (*session.Session, error) {
-	sqsSessionConfig := &aws.Config{
-		Region:      aws.String(config.Region),
-		Endpoint:    aws.String(config.SQSUrl),
-		MaxRetries:  aws.Int(3),
-		Credentials: credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
+	opts := []awssqs.SessionOption{
+		awssqs.WithRegion(config.Region),
 	}
-	sess, err := session.NewSession(sqsSessionConfig)
-	if err != nil {
-		return nil, err
+	if config.AccessKey != "" {
+		opts = append(opts, awssqs.WithStaticCredentials(config.AccessKey, config.SecretKey, ""))
 	}
-
-	return session.Must(sess, err), nil
+	if config.RoleARN != "" {
+		opts = append(opts, awssqs.WithAssumeRole(config.RoleARN, config.RoleExternalID, config.RoleSessionName))
+	}
+	if config.AWSEndpoint != "" {
+		opts = append(opts, awssqs.WithEndpoint(config.AWSEndpoint))
+	}
+	return awssqs.NewSession(opts...)
 }
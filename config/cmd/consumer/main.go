@@ -0,0 +1,90 @@
+// Command consumer runs the SQS consumer alone, without the HTTP server, logging every event it receives.
+// It's configured with the same environment variables as the worker, the flags override them.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"service-worker-sqs-postgres/config/cmd/builder"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/consumer"
+	repository "service-worker-sqs-postgres/dataproviders/postgres/repository/events"
+	"time"
+)
+
+// overrides are the flags of the command and the environment variable each one overrides.
+var overrides = map[string]string{
+	"queue":        "AWS_SQS_URL",
+	"region":       "AWS_REGION",
+	"db-host":      "DB_HOST",
+	"db-port":      "DB_PORT",
+	"db-name":      "DB_NAME",
+	"workers":      "AWS_SQS_WORKERS",
+	"max-messages": "AWS_SQS_MAX_MESSAGES",
+}
+
+func main() {
+	flag.String("queue", "", "comma separated URLs of the queues to consume, overrides AWS_SQS_URL")
+	flag.String("region", "", "aws region of the queues, overrides AWS_REGION")
+	flag.String("db-host", "", "host of the database, overrides DB_HOST")
+	flag.String("db-port", "", "port of the database, overrides DB_PORT")
+	flag.String("db-name", "", "name of the database, overrides DB_NAME")
+	flag.Int("workers", 0, "number of workers polling each queue, overrides AWS_SQS_WORKERS")
+	flag.Int("max-messages", 0, "max number of messages of each receive, overrides AWS_SQS_MAX_MESSAGES")
+	flag.Parse()
+
+	// logger is initialized
+	logger := builder.NewLogger()
+	logger.Info("Starting service-worker-sqs-postgres consumer ...")
+	defer builder.Sync(logger)
+
+	// the flags given override their environment variables
+	flag.Visit(func(f *flag.Flag) {
+		if err := os.Setenv(overrides[f.Name], f.Value.String()); err != nil {
+			logger.Fatalf("error setting flag %s : %v", f.Name, err)
+		}
+	})
+
+	// config is initialized
+	config, err := builder.LoadConfig()
+	if err != nil {
+		logger.Fatalf("error in LoadConfig : %v", err)
+	}
+
+	// session aws is initialized
+	session, err := builder.NewSession(config)
+	if err != nil {
+		logger.Fatalf("error in Session : %v", err)
+	}
+
+	// db is initialized
+	db, err := builder.NewDB(logger, config)
+	if err != nil {
+		logger.Fatalf("error in RDS : %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			logger.Errorf("error Closing RDS: %v", err)
+		}
+	}()
+
+	// sqs is initialized
+	eventRepository := repository.NewEventRepository(db, config.DBMaxRetries)
+	source, err := builder.NewSQS(logger, config, session, eventRepository, builder.NewMetrics())
+	if err != nil {
+		logger.Fatalf("error in SQS : %v", err)
+	}
+
+	// the events are logged until a shutdown signal
+	sqs := source.(*consumer.SQSSource)
+	err = sqs.RunWithSignals(context.Background(), func(ctx context.Context, e *domain.Event) error {
+		e.Log.Infof("Event %s received: %s", e.ID, e.Records.Message)
+		return nil
+	}, time.Duration(config.ShutdownTimeout)*time.Second)
+	if err != nil {
+		logger.Errorf("error Closing Consumer SQS: %v", err)
+	}
+
+	logger.Info("service-worker-sqs-postgres consumer ended")
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
-	"os"
-	"os/signal"
+	"context"
 	"service-worker-sqs-postgres/config/cmd/builder"
 	cases "service-worker-sqs-postgres/core/usecases/events"
 	repository "service-worker-sqs-postgres/dataproviders/postgres/repository/events"
 	"service-worker-sqs-postgres/dataproviders/server"
+	"service-worker-sqs-postgres/dataproviders/utils"
 	"service-worker-sqs-postgres/entrypoints/controllers/events"
-	"syscall"
+	"service-worker-sqs-postgres/entrypoints/controllers/health"
+	"time"
 )
 
 func main() {
@@ -31,13 +32,13 @@ func main() {
 	}
 
 	// db is initialized
-	db, err := builder.NewDB(config)
+	db, err := builder.NewDB(logger, config)
 	if err != nil {
 		logger.Fatalf("error in RDS : %v", err)
 	}
 
 	// repositories are initialized
-	eventRepository := repository.NewEventRepository(db)
+	eventRepository := repository.NewEventRepository(db, config.DBMaxRetries)
 
 	// usecases are initialized
 	eventUseCases := cases.NewEventUseCases(eventRepository)
@@ -45,8 +46,11 @@ func main() {
 	// controllers are initialized
 	eventController := events.NewEventController(eventUseCases)
 
+	// metrics are initialized
+	metrics := builder.NewMetrics()
+
 	// sqs is initialized
-	sqs, err := builder.NewSQS(logger, config, session, eventRepository)
+	sqs, err := builder.NewSQS(logger, config, session, eventRepository, metrics)
 	if err != nil {
 		logger.Fatalf("error in SQS : %v", err)
 	}
@@ -56,28 +60,48 @@ func main() {
 	if err != nil {
 		logger.Fatalf("error in Processor : %v", err)
 	}
-	go processor.Start()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go processor.Start(ctx)
 
-	// server is initialized
-	srv := server.NewServer(config.Port, eventController)
-	if err = srv.Start(); err != nil {
-		logger.Fatalf("error Starting Server: %v", err)
+	// outbox relay is initialized
+	relay, err := builder.NewOutboxRelay(logger, config, session, eventRepository)
+	if err != nil {
+		logger.Fatalf("error in Outbox : %v", err)
+	}
+	if relay != nil {
+		go relay.Run(ctx)
 	}
 
+	// server is initialized
+	healthController := health.NewHealthController(sqs)
+	srv := server.NewServer(config.Port, eventController, healthController, metrics.Handler())
+	go func() {
+		if err := srv.Start(); err != nil {
+			logger.Fatalf("error Starting Server: %v", err)
+		}
+	}()
+
 	// Graceful shutdown
-	sigQuit := make(chan os.Signal, 1)
-	signal.Notify(sigQuit, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGABRT, syscall.SIGTERM)
-	sig := <-sigQuit
+	sig := utils.WaitForSignal(ctx)
 
 	logger.Infof("Shutting down server with signal [%s] ...", sig.String())
-	if err = sqs.Close(); err != nil {
+	// the intake is stopped by Stop, ctx is only cancelled once the in-flight events ended
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(config.ShutdownTimeout)*time.Second)
+	defer shutdownCancel()
+	if err = processor.Stop(shutdownCtx); err != nil {
 		logger.Error("error Closing Consumer SQS: %v", err)
 	}
+	cancel()
 
 	if err = srv.Stop(); err != nil {
 		logger.Error("error Stopping Server: %v", err)
 	}
 
+	if err = db.Close(); err != nil {
+		logger.Error("error Closing RDS: %v", err)
+	}
+
 	logger.Info("service-worker-sqs-postgres ended")
 
 }
@@ -0,0 +1,59 @@
+// Command purge deletes every message of the SQS queues given with -queue, it's meant for test teardown
+// and emergency resets. The aws session is configured with the same environment variables as the worker.
+package main
+
+import (
+	"context"
+	"flag"
+	"service-worker-sqs-postgres/config/cmd/builder"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	env "service-worker-sqs-postgres/dataproviders/utils"
+	"strings"
+	"time"
+)
+
+func main() {
+	queues := flag.String("queue", "", "comma separated URLs of the queues to purge")
+	confirm := flag.Bool("confirm", false, "confirm the purge, the messages can't be recovered")
+	flag.Parse()
+
+	// logger is initialized
+	logger := builder.NewLogger()
+	defer builder.Sync(logger)
+
+	if *queues == "" || !*confirm {
+		logger.Fatalf("usage: purge -queue <url>[,<url>] -confirm")
+	}
+
+	// session aws is initialized
+	session, err := builder.NewSession(&builder.Configuration{
+		Region:          env.GetStringOrDefault("AWS_REGION", ""),
+		AccessKey:       env.GetStringOrDefault("AWS_ACCESS_KEY", ""),
+		SecretKey:       env.GetStringOrDefault("AWS_SECRET_KEY", ""),
+		AWSEndpoint:     env.GetStringOrDefault("AWS_ENDPOINT_URL", ""),
+		RoleARN:         env.GetStringOrDefault("AWS_ROLE_ARN", ""),
+		RoleExternalID:  env.GetStringOrDefault("AWS_ROLE_EXTERNAL_ID", ""),
+		RoleSessionName: env.GetStringOrDefault("AWS_ROLE_SESSION_NAME", "service-worker-sqs-postgres-purge"),
+	})
+	if err != nil {
+		logger.Fatalf("error in Session : %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, url := range strings.Split(*queues, ",") {
+		url = strings.TrimSpace(url)
+		var opts []awssqs.Option
+		if strings.HasSuffix(url, ".fifo") {
+			opts = append(opts, awssqs.WithFIFO(false))
+		}
+		client, err := awssqs.NewSQSClient(session, url, 1, 0, 0, opts...)
+		if err != nil {
+			logger.Fatalf("error awssqs.NewSQSClient: %v", err)
+		}
+		if err = client.PurgeQueue(ctx); err != nil {
+			logger.Fatalf("error purging queue %s: %v", url, err)
+		}
+		logger.Infof("Queue %s purged", url)
+	}
+}
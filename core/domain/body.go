@@ -0,0 +1,28 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// DecodeBody unmarshals the message of the record of an event into T, so the handlers get the payload typed.
+func DecodeBody[T any](e *Event) (T, error) {
+	var body T
+	if err := json.Unmarshal([]byte(e.Records.Message), &body); err != nil {
+		return body, fmt.Errorf("error decoding body of event %s: %w", e.ID, err)
+	}
+	return body, nil
+}
+
+// TypedHandler returns a Handler that decodes the body of the event into T before calling fn,
+// an event whose body isn't a valid T fails with the decoding error.
+func TypedHandler[T any](fn func(ctx context.Context, e *Event, body T) error) Handler {
+	return func(ctx context.Context, e *Event) error {
+		body, err := DecodeBody[T](e)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, e, body)
+	}
+}
@@ -0,0 +1,60 @@
+package domain_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"service-worker-sqs-postgres/core/domain"
+)
+
+type order struct {
+	OrderID string  `json:"order_id"`
+	Amount  float64 `json:"amount"`
+}
+
+func ExampleTypedHandler() {
+	handler := domain.TypedHandler(func(_ context.Context, e *domain.Event, body order) error {
+		fmt.Printf("event %s: order %s of %.2f\n", e.ID, body.OrderID, body.Amount)
+		return nil
+	})
+
+	event := &domain.Event{ID: "1", Records: domain.Events{Message: `{"order_id":"A-17","amount":12.5}`}}
+	if err := handler(context.Background(), event); err != nil {
+		fmt.Println(err)
+	}
+	// Output: event 1: order A-17 of 12.50
+}
+
+func TestTypedHandlerDecodeError(t *testing.T) {
+	called := false
+	handler := domain.TypedHandler(func(_ context.Context, _ *domain.Event, _ order) error {
+		called = true
+		return nil
+	})
+
+	event := &domain.Event{ID: "1", Records: domain.Events{Message: `{"order_id":`}}
+	err := handler(context.Background(), event)
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("handler returned %v, want the decoding error", err)
+	}
+	if !strings.Contains(err.Error(), "event 1") {
+		t.Fatalf("error %q doesn't name the event", err)
+	}
+	if called {
+		t.Fatal("handler called with a body that couldn't be decoded")
+	}
+}
+
+func TestDecodeBodyWrongType(t *testing.T) {
+	event := &domain.Event{ID: "1", Records: domain.Events{Message: `{"order_id":17}`}}
+	_, err := domain.DecodeBody[order](event)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || typeErr.Field != "order_id" {
+		t.Fatalf("DecodeBody returned %v, want a type error of order_id", err)
+	}
+}
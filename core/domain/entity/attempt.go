@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// Attempts represents the entity.
+type Attempts struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement;COLUMN:id" json:"id"`
+	EventID   string    `gorm:"NOT NULL;TYPE:VARCHAR(200);COLUMN:event_id;index" json:"event_id"`
+	Retry     int       `gorm:"NOT NULL;DEFAULT:0;COLUMN:retry" json:"retry"`
+	Outcome   string    `gorm:"NOT NULL;TYPE:VARCHAR(20);COLUMN:outcome" json:"outcome"`
+	Error     string    `gorm:"NULL;TYPE:TEXT;COLUMN:error" json:"error"`
+	CreatedAt time.Time `gorm:"COLUMN:created_at" json:"created_at"`
+}
+
+// TableName definition name for table .
+func (Attempts) TableName() string {
+	return "event_attempts"
+}
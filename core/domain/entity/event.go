@@ -1,10 +1,19 @@
 package entity
 
+import "time"
+
 // Events represents the entity.
 type Events struct {
-	ID      string `gorm:"NULL;TYPE:VARCHAR(200);COLUMN:id" json:"id"`
-	Message string `gorm:"NULL;TYPE:VARCHAR(200);COLUMN:message" json:"message"`
-	Date    string `gorm:"NULL;TYPE:VARCHAR(200);COLUMN:date" json:"date"`
+	ID            string     `gorm:"NULL;TYPE:VARCHAR(200);COLUMN:id" json:"id"`
+	Message       string     `gorm:"NULL;TYPE:VARCHAR(200);COLUMN:message" json:"message"`
+	Date          time.Time  `gorm:"NULL;COLUMN:date" json:"date"`
+	Status        string     `gorm:"NULL;TYPE:VARCHAR(20);COLUMN:status;index" json:"status"`
+	Retry         int        `gorm:"NOT NULL;DEFAULT:0;COLUMN:retry" json:"retry"`
+	LastError     string     `gorm:"NULL;TYPE:TEXT;COLUMN:last_error" json:"last_error"`
+	CreatedAt     time.Time  `gorm:"COLUMN:created_at" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"COLUMN:updated_at" json:"updated_at"`
+	ProcessedAt   *time.Time `gorm:"NULL;COLUMN:processed_at" json:"processed_at"`
+	CorrelationID string     `gorm:"NULL;TYPE:VARCHAR(200);COLUMN:correlation_id;index" json:"correlation_id"`
 }
 
 // TableName definition name for table .
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// Outbox represents the entity.
+type Outbox struct {
+	ID          string     `gorm:"primaryKey;TYPE:VARCHAR(200);COLUMN:id" json:"id"`
+	Body        string     `gorm:"NOT NULL;TYPE:TEXT;COLUMN:body" json:"body"`
+	Attributes  string     `gorm:"NULL;TYPE:TEXT;COLUMN:attributes" json:"attributes"`
+	Attempts    int        `gorm:"NOT NULL;DEFAULT:0;COLUMN:attempts" json:"attempts"`
+	LastError   string     `gorm:"NULL;TYPE:TEXT;COLUMN:last_error" json:"last_error"`
+	CreatedAt   time.Time  `gorm:"COLUMN:created_at;index" json:"created_at"`
+	PublishedAt *time.Time `gorm:"NULL;COLUMN:published_at;index" json:"published_at"`
+	LockedUntil *time.Time `gorm:"NULL;COLUMN:locked_until" json:"locked_until"`
+}
+
+// TableName definition name for table .
+func (Outbox) TableName() string {
+	return "outbox"
+}
@@ -1,8 +1,49 @@
 package domain
 
+import "time"
+
+// Status of an event along its processing.
+const (
+	StatusReceived   = "received"
+	StatusProcessing = "processing"
+	StatusProcessed  = "processed"
+	StatusFailed     = "failed"
+)
+
 // Events represents the entity.
 type Events struct {
-	ID      string `json:"id"`
-	Message string `json:"message"`
-	Date    string `json:"date"`
+	ID            string     `json:"id"`
+	Message       string     `json:"message"`
+	Date          time.Time  `json:"date"`
+	Status        string     `json:"status,omitempty"`
+	Retry         int        `json:"retry"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+	CorrelationID string     `json:"correlation_id,omitempty"`
+}
+
+// EventFilter selects the events of a listing, the empty fields don't filter.
+type EventFilter struct {
+	Status string
+	// From and To bound the date of the events, both inclusive.
+	From time.Time
+	To   time.Time
+}
+
+// Outcome of an attempt to process an event.
+const (
+	AttemptProcessed = "processed"
+	AttemptRetried   = "retried"
+	AttemptRejected  = "rejected"
+)
+
+// Attempt is a try to process an event, the history of the attempts of an event is kept for debugging.
+type Attempt struct {
+	EventID string    `json:"event_id"`
+	Retry   int       `json:"retry"`
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+	At      time.Time `json:"at"`
 }
@@ -12,8 +12,36 @@ var (
 	ErrInternalError      = errors.New("internal error")
 	ErrEntityAlreadyExist = errors.New("entity already exists")
 	ErrInvalidEntity      = errors.New("invalid Entity")
+	ErrUnavailable        = errors.New("service unavailable")
 )
 
+// kindError is an error of a kind caused by another error.
+type kindError struct {
+	kind error
+	err  error
+}
+
+// Wrap returns an error of kind caused by err, errors.Is matches kind and errors.As keeps finding
+// the errors in the chain of err.
+func Wrap(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// Error returns the kind followed by the cause.
+func (e *kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+// Is reports whether target is the kind of the error.
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unwrap returns the cause.
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
 // NewError returns a new controlled error.
 func NewError(code int, err error) *echo.HTTPError {
 	return echo.NewHTTPError(code, err.Error())
@@ -21,15 +49,17 @@ func NewError(code int, err error) *echo.HTTPError {
 
 // HandleServiceError returns an error according to its type.
 func HandleServiceError(err error) *echo.HTTPError {
-	switch err.Error() {
-	case ErrNotFound.Error():
+	switch {
+	case errors.Is(err, ErrNotFound):
 		return NewError(http.StatusNotFound, err)
-	case ErrInternalError.Error():
+	case errors.Is(err, ErrInternalError):
 		return NewError(http.StatusInternalServerError, err)
-	case ErrEntityAlreadyExist.Error():
+	case errors.Is(err, ErrEntityAlreadyExist):
 		return NewError(http.StatusConflict, err)
-	case ErrInvalidEntity.Error():
+	case errors.Is(err, ErrInvalidEntity):
 		return NewError(http.StatusUnprocessableEntity, err)
+	case errors.Is(err, ErrUnavailable):
+		return NewError(http.StatusServiceUnavailable, err)
 	default:
 		return NewError(http.StatusInternalServerError, err)
 	}
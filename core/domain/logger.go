@@ -0,0 +1,11 @@
+package domain
+
+// Logger is the logger of the consumer and the events, a zap adapter is provided by the logging package.
+type Logger interface {
+	Debugf(template string, args ...interface{})
+	Infof(template string, args ...interface{})
+	Warnf(template string, args ...interface{})
+	Errorf(template string, args ...interface{})
+	// With returns a logger adding the key-value pairs to every entry.
+	With(args ...interface{}) Logger
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "time"
+
+// OutboxMessage is a message to publish written in the same transaction as the change it announces,
+// the relay publishes it once the transaction is committed.
+type OutboxMessage struct {
+	ID          string            `json:"id"`
+	Body        string            `json:"body"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	Attempts    int               `json:"attempts"`
+	LastError   string            `json:"last_error,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	PublishedAt *time.Time        `json:"published_at,omitempty"`
+}
@@ -1,19 +1,52 @@
 package domain
 
-import "go.uber.org/zap"
+import (
+	"context"
+	"strconv"
+	"time"
+)
 
 // Event represents a process.
 type Event struct {
-	ID            string
-	Retry         string
+	ID string
+	// Retry is the receive count of the message, 0 when SQS didn't report it.
+	Retry int
+	// Queue is the URL of the queue the event was received from.
+	Queue         string
+	CorrelationID string
 	Records       Events
+	// Attributes are the string message attributes of the message, along with the attributes of its
+	// SNS notification.
+	Attributes map[string]string
+	// OriginalEvent is the raw message, a *sqs.Message, nil for a replayed event.
 	OriginalEvent interface{}
-	Log           *zap.SugaredLogger
+	Log           Logger
+	// StartedAt is when the event was produced, it carries the monotonic clock so the processing
+	// time measured from it isn't skewed by changes of the wall clock.
+	StartedAt time.Time
+	// Context carries the trace span of the event.
+	Context context.Context
+
+	// SentTimestamp is when the message was sent to the queue, zero when it's unknown.
+	SentTimestamp time.Time
+	// MessageGroupID is the FIFO group of the message, empty for standard queues.
+	MessageGroupID string
+}
+
+// RetryString returns the receive count of the message as SQS reports it.
+func (e *Event) RetryString() string {
+	return strconv.Itoa(e.Retry)
 }
 
+// Handler processes an event, a nil error acks the event.
+type Handler func(ctx context.Context, e *Event) error
+
 // Source represents a source of events.
 type Source interface {
-	Consume() <-chan *Event
+	Consume(ctx context.Context) <-chan *Event
 	Processed(e *Event) error
-	Close() error
+	Nack(e *Event, cause error) error
+	Close(ctx context.Context) error
+	Health(ctx context.Context) error
+	Liveness() error
 }
@@ -1,12 +1,14 @@
 package events
 
 import (
+	"context"
 	"service-worker-sqs-postgres/core/domain"
 	repository "service-worker-sqs-postgres/dataproviders/postgres/repository/events"
 )
 
 type IEventCaseUses interface {
 	GetID(ID string) (*domain.Events, error)
+	List(ctx context.Context, filter domain.EventFilter, limit, offset int) ([]*domain.Events, error)
 }
 
 // EventCaseUses encapsulates all the data necessary for the implementation of the EventsRepository.
@@ -25,3 +27,8 @@ func NewEventUseCases(er repository.IEventRepository) *EventCaseUses {
 func (es *EventCaseUses) GetID(ID string) (*domain.Events, error) {
 	return es.eventRepository.GetID(ID)
 }
+
+// List return the events matching filter.
+func (es *EventCaseUses) List(ctx context.Context, filter domain.EventFilter, limit, offset int) ([]*domain.Events, error) {
+	return es.eventRepository.List(ctx, filter, limit, offset)
+}
@@ -0,0 +1,64 @@
+package awss3
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"io"
+	"service-worker-sqs-postgres/dataproviders/utils"
+	"strings"
+)
+
+// Store keeps the message bodies too large for SQS in a bucket, it implements awssqs.PayloadStore.
+type Store struct {
+	api    s3iface.S3API
+	bucket string
+}
+
+// NewS3Store instances of a Store to keep the payloads in bucket with session as parameter.
+func NewS3Store(sess *session.Session, bucket string) (*Store, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("bucket is required to store the payloads")
+	}
+	return &Store{
+		api:    s3.New(sess),
+		bucket: bucket,
+	}, nil
+}
+
+// Put uploads body to the bucket with a new key and returns where it was stored.
+func (s *Store) Put(ctx context.Context, body string) (string, string, error) {
+	key := utils.NewID()
+	params := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   strings.NewReader(body),
+	}
+	if _, err := s.api.PutObjectWithContext(ctx, params); err != nil {
+		return "", "", fmt.Errorf("error uploading payload to s3://%s/%s: %w", s.bucket, key, err)
+	}
+
+	return s.bucket, key, nil
+}
+
+// Get downloads the payload stored in bucket under key.
+func (s *Store) Get(ctx context.Context, bucket, key string) (string, error) {
+	params := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	res, err := s.api.GetObjectWithContext(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("error downloading payload from s3://%s/%s: %w", bucket, key, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading payload from s3://%s/%s: %w", bucket, key, err)
+	}
+	return string(body), nil
+}
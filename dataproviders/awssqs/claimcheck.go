@@ -0,0 +1,88 @@
+package awssqs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// DefaultClaimCheckThreshold is the max body size SQS accepts, the larger bodies are offloaded.
+const DefaultClaimCheckThreshold = 256 * 1024
+
+// ExtendedPayloadSizeAttribute is the message attribute with the size of an offloaded body, as set
+// by the AWS extended client.
+const ExtendedPayloadSizeAttribute = "ExtendedPayloadSize"
+
+// payloadPointerClass tags the pointer bodies, so they're compatible with the AWS extended client.
+const payloadPointerClass = "software.amazon.payloadoffloading.PayloadS3Pointer"
+
+// PayloadStore keeps the message bodies too large for SQS, awss3.Store implements it.
+type PayloadStore interface {
+	Put(ctx context.Context, body string) (bucket, key string, err error)
+	Get(ctx context.Context, bucket, key string) (string, error)
+}
+
+// PayloadPointer is the body of a message whose payload was offloaded.
+type PayloadPointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// WithClaimCheck offloads to store the bodies over threshold bytes, the message carries a pointer to them.
+func WithClaimCheck(store PayloadStore, threshold int) Option {
+	return func(s *ClientSQS) {
+		s.payloads = store
+		s.claimThreshold = threshold
+	}
+}
+
+// offload stores the body of the input when it's over the threshold, the body and the attributes
+// to send are returned.
+func (s *ClientSQS) offload(ctx context.Context, input SendInput) (string, map[string]string, error) {
+	if s.payloads == nil || len(input.Body) <= s.claimThreshold {
+		return input.Body, input.Attributes, nil
+	}
+	bucket, key, err := s.payloads.Put(ctx, input.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	pointer, err := json.Marshal([]interface{}{payloadPointerClass, PayloadPointer{Bucket: bucket, Key: key}})
+	if err != nil {
+		return "", nil, err
+	}
+
+	attrs := make(map[string]string, len(input.Attributes)+1)
+	for name, value := range input.Attributes {
+		attrs[name] = value
+	}
+	attrs[ExtendedPayloadSizeAttribute] = strconv.Itoa(len(input.Body))
+	return string(pointer), attrs, nil
+}
+
+// ParsePointer reports whether body is the pointer to an offloaded payload.
+func ParsePointer(body string) (PayloadPointer, bool) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &parts); err != nil || len(parts) != 2 {
+		return PayloadPointer{}, false
+	}
+	var class string
+	var pointer PayloadPointer
+	if json.Unmarshal(parts[0], &class) != nil || class != payloadPointerClass || json.Unmarshal(parts[1], &pointer) != nil {
+		return PayloadPointer{}, false
+	}
+	return pointer, pointer.Bucket != "" && pointer.Key != ""
+}
+
+// ResolvePayload returns the payload of body, downloading it from store when body is a pointer.
+func ResolvePayload(ctx context.Context, store PayloadStore, body string) (string, error) {
+	pointer, ok := ParsePointer(body)
+	if !ok {
+		return body, nil
+	}
+	payload, err := store.Get(ctx, pointer.Bucket, pointer.Key)
+	if err != nil {
+		return "", fmt.Errorf("error resolving offloaded payload: %w", err)
+	}
+	return payload, nil
+}
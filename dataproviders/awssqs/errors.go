@@ -0,0 +1,38 @@
+package awssqs
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+)
+
+var (
+	// ErrThrottled is returned when SQS throttled the request, it's worth retrying later.
+	ErrThrottled = errors.New("sqs request throttled")
+	// ErrQueueNotFound is returned when the queue doesn't exist or was deleted.
+	ErrQueueNotFound = errors.New("sqs queue not found")
+)
+
+// queueNotFoundCodes are the codes SQS answers with when the queue doesn't exist, depending on the protocol.
+var queueNotFoundCodes = map[string]bool{
+	sqs.ErrCodeQueueDoesNotExist: true,
+	"QueueDoesNotExist":          true,
+}
+
+// classify wraps err with the sentinel error matching the aws error code, if any. The aws error is kept
+// in the chain, so errors.As still finds the awserr.Error.
+func classify(err error) error {
+	var awsErr awserr.Error
+	switch {
+	case err == nil:
+		return nil
+	case request.IsErrorThrottle(err) || (errors.As(err, &awsErr) && awsErr.Code() == sqs.ErrCodeOverLimit):
+		return exceptions.Wrap(ErrThrottled, err)
+	case errors.As(err, &awsErr) && queueNotFoundCodes[awsErr.Code()]:
+		return exceptions.Wrap(ErrQueueNotFound, err)
+	default:
+		return err
+	}
+}
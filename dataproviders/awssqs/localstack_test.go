@@ -0,0 +1,103 @@
+//go:build integration
+
+package awssqs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// startLocalstack runs a localstack container with SQS and returns its endpoint.
+func startLocalstack(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "localstack/localstack:2.1",
+			ExposedPorts: []string{"4566/tcp"},
+			Env:          map[string]string{"SERVICES": "sqs"},
+			WaitingFor:   wait.ForHTTP("/_localstack/health").WithPort("4566/tcp").WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		t.Fatalf("starting localstack: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := container.Terminate(ctx); err != nil {
+			t.Errorf("terminating localstack: %v", err)
+		}
+	})
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		t.Fatalf("localstack host: %v", err)
+	}
+	port, err := container.MappedPort(ctx, "4566/tcp")
+	if err != nil {
+		t.Fatalf("localstack port: %v", err)
+	}
+	return fmt.Sprintf("http://%s:%s", host, port.Port())
+}
+
+func TestLocalstackSendAndConsume(t *testing.T) {
+	sess, err := NewSession(WithEndpoint(startLocalstack(t)), WithRegion("us-east-1"), WithStaticCredentials("test", "test", ""))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	created, err := sqs.New(sess).CreateQueueWithContext(ctx, &sqs.CreateQueueInput{QueueName: aws.String("events")})
+	if err != nil {
+		t.Fatalf("CreateQueue: %v", err)
+	}
+	client, err := NewSQSClient(sess, aws.StringValue(created.QueueUrl), MaxReceiveMessages, 30, 1)
+	if err != nil {
+		t.Fatalf("NewSQSClient: %v", err)
+	}
+	if err := client.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	id, err := client.SendMessage(ctx, `{"id":"1","message":"hello"}`, map[string]string{"source": "localstack"})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	var messages []*sqs.Message
+	for len(messages) == 0 && ctx.Err() == nil {
+		if messages, err = client.GetMessages(ctx); err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+	}
+	if len(messages) != 1 || aws.StringValue(messages[0].MessageId) != id {
+		t.Fatalf("received %v, want the message %s", messages, id)
+	}
+	msg := messages[0]
+	if body := aws.StringValue(msg.Body); body != `{"id":"1","message":"hello"}` {
+		t.Fatalf("received body %q", body)
+	}
+	if source := msg.MessageAttributes["source"]; source == nil || aws.StringValue(source.StringValue) != "localstack" {
+		t.Fatalf("received message attributes %v, want the source sent", msg.MessageAttributes)
+	}
+	if count := aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]); count != "1" {
+		t.Fatalf("receive count %q, want 1", count)
+	}
+
+	if err := client.DeleteMessage(ctx, msg); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	attrs, err := client.GetQueueAttributes(ctx)
+	if err != nil {
+		t.Fatalf("GetQueueAttributes: %v", err)
+	}
+	if attrs.Visible != 0 || attrs.NotVisible != 0 {
+		t.Fatalf("%d messages visible and %d not visible after the delete", attrs.Visible, attrs.NotVisible)
+	}
+}
@@ -0,0 +1,199 @@
+package awssqs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+const (
+	fifoSuffix          = ".fifo"
+	defaultMessageGroup = "default"
+)
+
+// Sender represents the SQS operations used to publish messages, ClientSQS implements it.
+type Sender interface {
+	SendMessage(ctx context.Context, body string, attrs map[string]string) (string, error)
+	Send(ctx context.Context, input SendInput) (string, error)
+	SendMessageBatch(ctx context.Context, inputs []SendInput) ([]SendResult, error)
+}
+
+// MaxDelaySeconds is the max delay of a message, 15 minutes.
+const MaxDelaySeconds = 900
+
+// SendInput is a message to publish, ID is chosen by the caller to correlate the results of a batch.
+// GroupID and DeduplicationID only apply to FIFO queues. DelaySeconds postpones the delivery of the
+// message, from 0 to MaxDelaySeconds; FIFO queues don't support a delay per message, only on the queue.
+type SendInput struct {
+	ID              string
+	Body            string
+	Attributes      map[string]string
+	GroupID         string
+	DeduplicationID string
+	DelaySeconds    int
+}
+
+// SendResult is the outcome of an entry of a batch publication, Err is set when SQS rejected the entry.
+type SendResult struct {
+	ID        string
+	MessageID string
+	Err       error
+}
+
+// SendMessage publishes a message with attrs as string message attributes and returns its ID,
+// on FIFO queues the message goes to the default group.
+func (s *ClientSQS) SendMessage(ctx context.Context, body string, attrs map[string]string) (string, error) {
+	return s.Send(ctx, SendInput{Body: body, Attributes: attrs})
+}
+
+// Send publishes a message and returns its ID, with a claim check a large body is offloaded first.
+func (s *ClientSQS) Send(ctx context.Context, input SendInput) (string, error) {
+	delay, err := s.delaySeconds(input.DelaySeconds)
+	if err != nil {
+		return "", err
+	}
+	body, attrs, err := s.offload(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	params := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(s.url),
+		MessageBody:       aws.String(body),
+		MessageAttributes: stringAttributes(attrs),
+		DelaySeconds:      delay,
+	}
+	params.MessageGroupId, params.MessageDeduplicationId = s.fifoFields(input)
+
+	res, err := s.api.SendMessageWithContext(ctx, params)
+	if err != nil {
+		return "", classify(err)
+	}
+
+	return aws.StringValue(res.MessageId), nil
+}
+
+// SendMessageBatch publishes the inputs in requests of up to 10 entries and returns a result per input.
+// The entries rejected by SQS are reported in their result, while a failed request returns an error
+// together with the results of the requests already sent.
+func (s *ClientSQS) SendMessageBatch(ctx context.Context, inputs []SendInput) ([]SendResult, error) {
+	results := make([]SendResult, 0, len(inputs))
+	for start := 0; start < len(inputs); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		batch := inputs[start:end]
+
+		entries := make([]*sqs.SendMessageBatchRequestEntry, 0, len(batch))
+		for i, input := range batch {
+			delay, err := s.delaySeconds(input.DelaySeconds)
+			if err != nil {
+				return results, fmt.Errorf("error in sqs batch entry %s: %w", input.ID, err)
+			}
+			body, attrs, err := s.offload(ctx, input)
+			if err != nil {
+				return results, fmt.Errorf("error offloading sqs batch entry %s: %w", input.ID, err)
+			}
+			entry := &sqs.SendMessageBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				MessageBody:       aws.String(body),
+				MessageAttributes: stringAttributes(attrs),
+				DelaySeconds:      delay,
+			}
+			entry.MessageGroupId, entry.MessageDeduplicationId = s.fifoFields(input)
+			entries = append(entries, entry)
+		}
+		params := &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(s.url),
+			Entries:  entries,
+		}
+
+		res, err := s.api.SendMessageBatchWithContext(ctx, params)
+		if err != nil {
+			return results, fmt.Errorf("error sending sqs batch of %d entries: %w", len(batch), classify(err))
+		}
+
+		batchResults := make([]SendResult, len(batch))
+		for i, input := range batch {
+			batchResults[i].ID = input.ID
+		}
+		for _, entry := range res.Successful {
+			i, _ := strconv.Atoi(aws.StringValue(entry.Id))
+			batchResults[i].MessageID = aws.StringValue(entry.MessageId)
+		}
+		for _, entry := range res.Failed {
+			i, _ := strconv.Atoi(aws.StringValue(entry.Id))
+			batchResults[i].Err = fmt.Errorf("%s: %s", aws.StringValue(entry.Code), aws.StringValue(entry.Message))
+		}
+		results = append(results, batchResults...)
+	}
+
+	return results, nil
+}
+
+// delaySeconds validates the delay of a message, nil when there is none.
+func (s *ClientSQS) delaySeconds(seconds int) (*int64, error) {
+	if seconds < 0 || seconds > MaxDelaySeconds {
+		return nil, fmt.Errorf("delay must be between 0 and %d seconds, got %d", MaxDelaySeconds, seconds)
+	}
+	if seconds == 0 {
+		return nil, nil
+	}
+	if s.fifo {
+		return nil, fmt.Errorf("fifo queue %s doesn't support a delay per message", s.url)
+	}
+	return aws.Int64(int64(seconds)), nil
+}
+
+// fifoFields returns the group and deduplication ID required by FIFO queues, both are nil for standard queues.
+// Without a group the message goes to the default group, and without a deduplication ID the message is
+// deduplicated by the hash of the body unless the queue uses content-based deduplication.
+func (s *ClientSQS) fifoFields(input SendInput) (*string, *string) {
+	if !s.fifo {
+		return nil, nil
+	}
+	group := input.GroupID
+	if group == "" {
+		group = defaultMessageGroup
+	}
+	if input.DeduplicationID != "" {
+		return aws.String(group), aws.String(input.DeduplicationID)
+	}
+	if s.contentDedup {
+		return aws.String(group), nil
+	}
+	hash := sha256.Sum256([]byte(input.Body))
+	return aws.String(group), aws.String(hex.EncodeToString(hash[:]))
+}
+
+// stringAttributes converts attrs to SQS string message attributes.
+func stringAttributes(attrs map[string]string) map[string]*sqs.MessageAttributeValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(attrs))
+	for name, value := range attrs {
+		attributes[name] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	return attributes
+}
+
+// ChangeMessageVisibility sets the seconds the message stays hidden from now on.
+func (s *ClientSQS) ChangeMessageVisibility(ctx context.Context, msg *sqs.Message, seconds int) error {
+	params := &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(s.url),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(int64(seconds)),
+	}
+	_, err := s.api.ChangeMessageVisibilityWithContext(ctx, params)
+
+	return classify(err)
+}
@@ -0,0 +1,93 @@
+package awssqs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"time"
+)
+
+// defaultMaxRetries is the number of retries of the aws requests failed by a transient error.
+const defaultMaxRetries = 3
+
+// defaultRoleSessionName identifies the sessions of the assumed role in CloudTrail when no name is given.
+const defaultRoleSessionName = "service-worker-sqs-postgres"
+
+// roleExpiryWindow is how long before they expire the credentials of the assumed role are refreshed,
+// so a request in-flight doesn't fail with expired credentials.
+const roleExpiryWindow = time.Minute
+
+// sessionConfig is the configuration of the session built by NewSession.
+type sessionConfig struct {
+	aws             *aws.Config
+	roleARN         string
+	externalID      string
+	roleSessionName string
+}
+
+// SessionOption configures the aws session used by the clients.
+type SessionOption func(*sessionConfig)
+
+// WithRegion sets the region of the session.
+func WithRegion(region string) SessionOption {
+	return func(c *sessionConfig) {
+		c.aws.Region = aws.String(region)
+	}
+}
+
+// WithStaticCredentials authenticates the session with an access key, token is only
+// needed for temporary credentials.
+func WithStaticCredentials(accessKey, secretKey, token string) SessionOption {
+	return func(c *sessionConfig) {
+		c.aws.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, token)
+	}
+}
+
+// WithEndpoint sends the requests to endpoint instead of the aws one, for example http://localhost:4566
+// for localstack. The S3 requests use path-style addressing, since the emulators don't resolve bucket hosts.
+func WithEndpoint(endpoint string) SessionOption {
+	return func(c *sessionConfig) {
+		c.aws.Endpoint = aws.String(endpoint)
+		c.aws.S3ForcePathStyle = aws.Bool(true)
+	}
+}
+
+// WithAssumeRole authenticates the session with the STS credentials of roleARN, for example to consume
+// a queue of another account. The role is assumed with the static or default chain credentials, externalID
+// is only sent when it isn't empty and an empty sessionName keeps the default one. The credentials are
+// refreshed before they expire.
+func WithAssumeRole(roleARN, externalID, sessionName string) SessionOption {
+	return func(c *sessionConfig) {
+		c.roleARN = roleARN
+		c.externalID = externalID
+		if sessionName != "" {
+			c.roleSessionName = sessionName
+		}
+	}
+}
+
+// NewSession returns an aws session, without credentials options they're resolved by the default chain
+// of the sdk: the environment, the shared credentials file and the role of the instance or the task.
+func NewSession(opts ...SessionOption) (*session.Session, error) {
+	config := &sessionConfig{
+		aws:             &aws.Config{MaxRetries: aws.Int(defaultMaxRetries)},
+		roleSessionName: defaultRoleSessionName,
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	sess, err := session.NewSession(config.aws)
+	if err != nil || config.roleARN == "" {
+		return sess, err
+	}
+	creds := stscreds.NewCredentials(sess, config.roleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = config.roleSessionName
+		p.ExpiryWindow = roleExpiryWindow
+		if config.externalID != "" {
+			p.ExternalID = aws.String(config.externalID)
+		}
+	})
+	return sess.Copy(&aws.Config{Credentials: creds}), nil
+}
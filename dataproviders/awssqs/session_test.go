@@ -0,0 +1,23 @@
+package awssqs
+
+import "testing"
+
+func TestWithAssumeRoleKeepsDefaultSessionName(t *testing.T) {
+	tests := []struct {
+		name        string
+		sessionName string
+		want        string
+	}{
+		{name: "empty", sessionName: "", want: defaultRoleSessionName},
+		{name: "given", sessionName: "worker", want: "worker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &sessionConfig{roleSessionName: defaultRoleSessionName}
+			WithAssumeRole("arn:aws:iam::000000000000:role/consumer", "", tt.sessionName)(config)
+			if config.roleSessionName != tt.want {
+				t.Fatalf("role session name %q, want %q", config.roleSessionName, tt.want)
+			}
+		})
+	}
+}
@@ -1,60 +1,362 @@
 package awssqs
 
 import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
 )
 
+// DefaultWaitTimeSeconds is the long polling wait used by default, the max allowed by SQS.
+const DefaultWaitTimeSeconds = MaxWaitTimeSeconds
+
+const (
+	// MaxWaitTimeSeconds is the max long polling wait SQS allows.
+	MaxWaitTimeSeconds = 20
+	// MaxVisibilityTimeout is the max visibility timeout in seconds SQS allows.
+	MaxVisibilityTimeout = 43200
+)
+
+// MaxReceiveMessages is the max number of messages SQS returns in a receive.
+const MaxReceiveMessages = 10
+
+// maxBatchSize is the max number of entries SQS accepts in a batch request.
+const maxBatchSize = 10
+
+// BatchError reports the entries that SQS couldn't process in a batch request, keyed by message ID.
+type BatchError struct {
+	Failed map[string]string
+}
+
+// Error returns the number of failed entries.
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d entries failed in the sqs batch request", len(e.Failed))
+}
+
+// Client represents the SQS operations used by the consumer, ClientSQS implements it.
+type Client interface {
+	URL() string
+	GetMessages(ctx context.Context) ([]*sqs.Message, error)
+	DeleteMessage(ctx context.Context, msg *sqs.Message) error
+	DeleteMessageBatch(ctx context.Context, messages []*sqs.Message) error
+	Forward(ctx context.Context, msg *sqs.Message, attrs map[string]string) error
+	Requeue(ctx context.Context, msg *sqs.Message, attrs map[string]string, delaySeconds int) error
+	ChangeMessageVisibility(ctx context.Context, msg *sqs.Message, seconds int) error
+	GetQueueAttributes(ctx context.Context) (QueueAttributes, error)
+	Ping(ctx context.Context) error
+}
+
 // ClientSQS represents SQS client.
 type ClientSQS struct {
 	api               sqsiface.SQSAPI
 	url               string
 	maxMessages       int64
 	visibilityTimeout int64
+	waitTimeSeconds   int64
+	fifo              bool
+	contentDedup      bool
+	payloads          PayloadStore
+	claimThreshold    int
+	attributeNames    []*string
+	messageAttributes []*string
+}
+
+// Option configures an optional behaviour of the ClientSQS.
+type Option func(*ClientSQS)
+
+// WithFIFO marks the queue as FIFO, the messages sent carry a group and a deduplication ID.
+// contentBasedDedup leaves the deduplication to the queue when no ID is given.
+func WithFIFO(contentBasedDedup bool) Option {
+	return func(s *ClientSQS) {
+		s.fifo = true
+		s.contentDedup = contentBasedDedup
+	}
+}
+
+// allAttributes requests every system or message attribute on receive.
+const allAttributes = "All"
+
+// requiredAttributes are the system attributes the consumer reads, they're always requested on receive.
+var requiredAttributes = []string{
+	sqs.MessageSystemAttributeNameApproximateReceiveCount,
+	sqs.MessageSystemAttributeNameMessageGroupId,
+	sqs.MessageSystemAttributeNameSentTimestamp,
+}
+
+// requiredMessageAttributes are the message attributes the consumer reads, they're always requested on receive.
+var requiredMessageAttributes = []string{"correlation-id", "retry-count", "traceparent"}
+
+// WithAttributeNames sets the system attributes requested on receive, All by default. The
+// ApproximateReceiveCount, MessageGroupId and SentTimestamp attributes are always requested since
+// the consumer reads them.
+func WithAttributeNames(names ...string) Option {
+	return func(s *ClientSQS) {
+		s.attributeNames = aws.StringSlice(names)
+	}
+}
+
+// WithMessageAttributeNames sets the message attributes requested on receive, All by default. The
+// names may end in .* to request every attribute with a prefix, as SQS allows. The correlation-id,
+// retry-count and traceparent attributes are always requested since the consumer reads them.
+func WithMessageAttributeNames(names ...string) Option {
+	return func(s *ClientSQS) {
+		s.messageAttributes = aws.StringSlice(names)
+	}
+}
+
+// withRequired adds to the names requested the required ones they don't include, by name or prefix.
+func withRequired(names []*string, required []string) []*string {
+	for _, want := range required {
+		if !requests(names, want) {
+			names = append(names, aws.String(want))
+		}
+	}
+	return names
+}
+
+// requests reports whether the names requested include name.
+func requests(names []*string, name string) bool {
+	for _, requested := range aws.StringValueSlice(names) {
+		if requested == allAttributes || requested == name {
+			return true
+		}
+		if prefix := strings.TrimSuffix(requested, "*"); prefix != requested && strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 // NewSQSClient instances of a Client to connect SQS with session as parameter.
-func NewSQSClient(sess *session.Session, url string, maxMessages, visibilityTimeout int) (*ClientSQS, error) {
-	return &ClientSQS{
+// visibilityTimeout is the seconds a received message stays hidden from other receives, up to 12 hours.
+// waitTimeSeconds enables the long polling when greater than zero, SQS allows up to 20 seconds.
+func NewSQSClient(sess *session.Session, url string, maxMessages, visibilityTimeout, waitTimeSeconds int, opts ...Option) (*ClientSQS, error) {
+	if maxMessages < 1 || maxMessages > MaxReceiveMessages {
+		return nil, fmt.Errorf("max messages must be between 1 and %d, got %d", MaxReceiveMessages, maxMessages)
+	}
+	if visibilityTimeout < 0 || visibilityTimeout > MaxVisibilityTimeout {
+		return nil, fmt.Errorf("visibility timeout must be between 0 and %d seconds, got %d", MaxVisibilityTimeout, visibilityTimeout)
+	}
+	if waitTimeSeconds < 0 || waitTimeSeconds > MaxWaitTimeSeconds {
+		return nil, fmt.Errorf("wait time seconds must be between 0 and %d, got %d", MaxWaitTimeSeconds, waitTimeSeconds)
+	}
+
+	client := &ClientSQS{
 		api:               sqs.New(sess),
 		url:               url,
 		maxMessages:       int64(maxMessages),
 		visibilityTimeout: int64(visibilityTimeout),
-	}, nil
+		waitTimeSeconds:   int64(waitTimeSeconds),
+	}
+	client.attributeNames = aws.StringSlice([]string{allAttributes})
+	client.messageAttributes = aws.StringSlice([]string{allAttributes})
+	for _, opt := range opts {
+		opt(client)
+	}
+	client.attributeNames = withRequired(client.attributeNames, requiredAttributes)
+	client.messageAttributes = withRequired(client.messageAttributes, requiredMessageAttributes)
+	if client.payloads != nil && (client.claimThreshold < 1 || client.claimThreshold > DefaultClaimCheckThreshold) {
+		return nil, fmt.Errorf("claim check threshold must be between 1 and %d bytes, got %d", DefaultClaimCheckThreshold, client.claimThreshold)
+	}
+	if client.fifo != strings.HasSuffix(url, fifoSuffix) {
+		return nil, fmt.Errorf("queue %s: FIFO queue names must end in %s and only FIFO queues can use it", url, fifoSuffix)
+	}
+
+	return client, nil
+}
+
+// URL returns the URL of the queue.
+func (s *ClientSQS) URL() string {
+	return s.url
 }
 
-// GetMessages retrieves messages from SQS.
-func (s *ClientSQS) GetMessages() ([]*sqs.Message, error) {
+// receiveLimitKey is the context key of the limit of messages of a receive.
+type receiveLimitKey struct{}
+
+// WithReceiveLimit returns a context that makes GetMessages request at most n messages, the max messages
+// of the client still bounds the receive.
+func WithReceiveLimit(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, receiveLimitKey{}, n)
+}
+
+// GetMessages retrieves messages from SQS, the receive is aborted when ctx is done.
+func (s *ClientSQS) GetMessages(ctx context.Context) ([]*sqs.Message, error) {
+	maxMessages := s.maxMessages
+	if n, ok := ctx.Value(receiveLimitKey{}).(int); ok && n > 0 && int64(n) < maxMessages {
+		maxMessages = int64(n)
+	}
 	params := &sqs.ReceiveMessageInput{
-		QueueUrl:            aws.String(s.url),
-		MaxNumberOfMessages: aws.Int64(s.maxMessages),
-		AttributeNames: []*string{
-			aws.String("All"),
-		},
-		MessageAttributeNames: []*string{
-			aws.String("All"),
-		},
-		WaitTimeSeconds:   aws.Int64(20),
-		VisibilityTimeout: aws.Int64(s.visibilityTimeout),
+		QueueUrl:              aws.String(s.url),
+		MaxNumberOfMessages:   aws.Int64(maxMessages),
+		AttributeNames:        s.attributeNames,
+		MessageAttributeNames: s.messageAttributes,
+		WaitTimeSeconds:       aws.Int64(s.waitTimeSeconds),
+		VisibilityTimeout:     aws.Int64(s.visibilityTimeout),
 	}
 
-	res, err := s.api.ReceiveMessage(params)
+	res, err := s.api.ReceiveMessageWithContext(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
 
 	return res.Messages, nil
 }
 
 // DeleteMessage deletes messages from SQS.
-func (s *ClientSQS) DeleteMessage(msg *sqs.Message) error {
+func (s *ClientSQS) DeleteMessage(ctx context.Context, msg *sqs.Message) error {
 	params := &sqs.DeleteMessageInput{
 		QueueUrl:      aws.String(s.url),
 		ReceiptHandle: msg.ReceiptHandle,
 	}
-	_, err := s.api.DeleteMessage(params)
+	_, err := s.api.DeleteMessageWithContext(ctx, params)
+
+	return classify(err)
+}
+
+// DeleteMessageBatch deletes messages from SQS in requests of up to 10 entries.
+// The entries rejected by SQS are returned in a *BatchError.
+func (s *ClientSQS) DeleteMessageBatch(ctx context.Context, messages []*sqs.Message) error {
+	failed := make(map[string]string)
+	for start := 0; start < len(messages); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(messages) {
+			end = len(messages)
+		}
+		batch := messages[start:end]
+
+		entries := make([]*sqs.DeleteMessageBatchRequestEntry, 0, len(batch))
+		for i, msg := range batch {
+			entries = append(entries, &sqs.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: msg.ReceiptHandle,
+			})
+		}
+		params := &sqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(s.url),
+			Entries:  entries,
+		}
+
+		res, err := s.api.DeleteMessageBatchWithContext(ctx, params)
+		if err != nil {
+			return classify(err)
+		}
+		for _, entry := range res.Failed {
+			i, _ := strconv.Atoi(aws.StringValue(entry.Id))
+			failed[aws.StringValue(batch[i].MessageId)] = aws.StringValue(entry.Message)
+		}
+	}
+	if len(failed) > 0 {
+		return &BatchError{Failed: failed}
+	}
+
+	return nil
+}
+
+// Forward sends the body and the message attributes of msg to the queue of this client,
+// attrs are added as string message attributes.
+func (s *ClientSQS) Forward(ctx context.Context, msg *sqs.Message, attrs map[string]string) error {
+	return s.forward(ctx, msg, attrs, 0)
+}
+
+// Requeue sends msg like Forward to be delivered again after delaySeconds, from 0 to MaxDelaySeconds.
+// The copy is a new message, its receive count starts again.
+func (s *ClientSQS) Requeue(ctx context.Context, msg *sqs.Message, attrs map[string]string, delaySeconds int) error {
+	return s.forward(ctx, msg, attrs, delaySeconds)
+}
+
+// forward sends the body and the message attributes of msg along with attrs, delayed delaySeconds.
+func (s *ClientSQS) forward(ctx context.Context, msg *sqs.Message, attrs map[string]string, delaySeconds int) error {
+	delay, err := s.delaySeconds(delaySeconds)
+	if err != nil {
+		return err
+	}
+	attributes := make(map[string]*sqs.MessageAttributeValue, len(msg.MessageAttributes)+len(attrs))
+	for name, value := range msg.MessageAttributes {
+		attributes[name] = value
+	}
+	for name, value := range stringAttributes(attrs) {
+		attributes[name] = value
+	}
+
+	params := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(s.url),
+		MessageBody:       msg.Body,
+		MessageAttributes: attributes,
+		DelaySeconds:      delay,
+	}
+	params.MessageGroupId, params.MessageDeduplicationId = s.fifoFields(SendInput{
+		Body:    aws.StringValue(msg.Body),
+		GroupID: aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]),
+	})
+	_, err = s.api.SendMessageWithContext(ctx, params)
+
+	return classify(err)
+}
+
+// Ping checks the queue is reachable by reading its ARN.
+func (s *ClientSQS) Ping(ctx context.Context) error {
+	params := &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(s.url),
+		AttributeNames: []*string{aws.String(sqs.QueueAttributeNameQueueArn)},
+	}
+	_, err := s.api.GetQueueAttributesWithContext(ctx, params)
+
+	return classify(err)
+}
+
+// QueueAttributes are the approximate number of messages of a queue, SQS computes them eventually
+// so they can lag behind the actual queue for a minute.
+type QueueAttributes struct {
+	// Visible are the messages available to be received.
+	Visible int64
+	// NotVisible are the messages in-flight, received but not deleted yet.
+	NotVisible int64
+	// Delayed are the messages not available yet because of their delay.
+	Delayed int64
+}
+
+// GetQueueAttributes reads the approximate number of messages of the queue.
+func (s *ClientSQS) GetQueueAttributes(ctx context.Context) (QueueAttributes, error) {
+	params := &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(s.url),
+		AttributeNames: []*string{
+			aws.String(sqs.QueueAttributeNameApproximateNumberOfMessages),
+			aws.String(sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible),
+			aws.String(sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed),
+		},
+	}
+	res, err := s.api.GetQueueAttributesWithContext(ctx, params)
+	if err != nil {
+		return QueueAttributes{}, classify(err)
+	}
+
+	var attrs QueueAttributes
+	for name, target := range map[string]*int64{
+		sqs.QueueAttributeNameApproximateNumberOfMessages:           &attrs.Visible,
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: &attrs.NotVisible,
+		sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    &attrs.Delayed,
+	} {
+		if *target, err = strconv.ParseInt(aws.StringValue(res.Attributes[name]), 10, 64); err != nil {
+			return QueueAttributes{}, fmt.Errorf("error parsing queue attribute %s: %w", name, err)
+		}
+	}
+	return attrs, nil
+}
+
+// PurgeQueue deletes every message of the queue, it's destructive and can't be undone. SQS allows one purge
+// of a queue every 60 seconds and the purge can take up to 60 seconds, the messages sent meanwhile may be
+// deleted too. The error of SQS is returned as is, so a purge too soon is detected by its
+// awserr.Error code sqs.ErrCodePurgeQueueInProgress.
+func (s *ClientSQS) PurgeQueue(ctx context.Context) error {
+	params := &sqs.PurgeQueueInput{
+		QueueUrl: aws.String(s.url),
+	}
+	_, err := s.api.PurgeQueueWithContext(ctx, params)
 
 	return err
 }
@@ -0,0 +1,115 @@
+package awssqs
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+)
+
+const testQueueURL = "https://sqs.us-east-1.amazonaws.com/000000000000/events"
+
+// recordingAPI records the receive requests, the other SQS operations aren't implemented.
+type recordingAPI struct {
+	sqsiface.SQSAPI
+	inputs []*sqs.ReceiveMessageInput
+}
+
+func (a *recordingAPI) ReceiveMessageWithContext(_ aws.Context, input *sqs.ReceiveMessageInput, _ ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	a.inputs = append(a.inputs, input)
+	return &sqs.ReceiveMessageOutput{}, nil
+}
+
+// newRecordingClient creates a client sending its requests to the returned api.
+func newRecordingClient(t *testing.T, maxMessages, visibilityTimeout, waitTimeSeconds int, opts ...Option) (*ClientSQS, *recordingAPI) {
+	t.Helper()
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1")}))
+	client, err := NewSQSClient(sess, testQueueURL, maxMessages, visibilityTimeout, waitTimeSeconds, opts...)
+	if err != nil {
+		t.Fatalf("NewSQSClient: %v", err)
+	}
+	api := &recordingAPI{}
+	client.api = api
+	return client, api
+}
+
+func TestGetMessagesInput(t *testing.T) {
+	tests := []struct {
+		name              string
+		maxMessages       int
+		visibilityTimeout int
+		waitTimeSeconds   int
+		limit             int
+		wantMax           int64
+	}{
+		{name: "short polling", maxMessages: 10, visibilityTimeout: 30, waitTimeSeconds: 0, wantMax: 10},
+		{name: "long polling", maxMessages: 5, visibilityTimeout: 60, waitTimeSeconds: 20, wantMax: 5},
+		{name: "custom wait", maxMessages: 10, visibilityTimeout: 0, waitTimeSeconds: 7, wantMax: 10},
+		{name: "receive limit", maxMessages: 10, visibilityTimeout: 30, waitTimeSeconds: 20, limit: 3, wantMax: 3},
+		{name: "limit above max messages", maxMessages: 4, visibilityTimeout: 30, waitTimeSeconds: 20, limit: 8, wantMax: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, api := newRecordingClient(t, tt.maxMessages, tt.visibilityTimeout, tt.waitTimeSeconds)
+			ctx := context.Background()
+			if tt.limit > 0 {
+				ctx = WithReceiveLimit(ctx, tt.limit)
+			}
+			if _, err := client.GetMessages(ctx); err != nil {
+				t.Fatalf("GetMessages: %v", err)
+			}
+			if len(api.inputs) != 1 {
+				t.Fatalf("%d receives sent, want 1", len(api.inputs))
+			}
+			input := api.inputs[0]
+			if got := aws.StringValue(input.QueueUrl); got != testQueueURL {
+				t.Errorf("QueueUrl = %q, want %q", got, testQueueURL)
+			}
+			if got := aws.Int64Value(input.WaitTimeSeconds); got != int64(tt.waitTimeSeconds) {
+				t.Errorf("WaitTimeSeconds = %d, want %d", got, tt.waitTimeSeconds)
+			}
+			if got := aws.Int64Value(input.VisibilityTimeout); got != int64(tt.visibilityTimeout) {
+				t.Errorf("VisibilityTimeout = %d, want %d", got, tt.visibilityTimeout)
+			}
+			if got := aws.Int64Value(input.MaxNumberOfMessages); got != tt.wantMax {
+				t.Errorf("MaxNumberOfMessages = %d, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestGetMessagesAttributeNames(t *testing.T) {
+	client, api := newRecordingClient(t, 10, 30, 20,
+		WithAttributeNames("SentTimestamp"), WithMessageAttributeNames("trace-id", "retry.*", "retry-count"))
+	if _, err := client.GetMessages(context.Background()); err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	input := api.inputs[0]
+	want := []string{"SentTimestamp", sqs.MessageSystemAttributeNameApproximateReceiveCount, sqs.MessageSystemAttributeNameMessageGroupId}
+	if got := aws.StringValueSlice(input.AttributeNames); !reflect.DeepEqual(got, want) {
+		t.Errorf("AttributeNames = %v, want %v with the attributes of the consumer added", got, want)
+	}
+	want = []string{"trace-id", "retry.*", "retry-count", "correlation-id", "traceparent"}
+	if got := aws.StringValueSlice(input.MessageAttributeNames); !reflect.DeepEqual(got, want) {
+		t.Errorf("MessageAttributeNames = %v, want %v with the attributes of the consumer added", got, want)
+	}
+}
+
+func TestGetMessagesAllAttributes(t *testing.T) {
+	client, api := newRecordingClient(t, 10, 30, 20)
+	if _, err := client.GetMessages(context.Background()); err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	input := api.inputs[0]
+	if got := aws.StringValueSlice(input.AttributeNames); len(got) != 1 || got[0] != "All" {
+		t.Errorf("AttributeNames = %v, want [All]", got)
+	}
+	if got := aws.StringValueSlice(input.MessageAttributeNames); len(got) != 1 || got[0] != "All" {
+		t.Errorf("MessageAttributeNames = %v, want [All]", got)
+	}
+}
@@ -0,0 +1,25 @@
+package codec
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// The bodies of the SQS messages are text, so the binary codecs carry their payload encoded in base64.
+
+// decodeBase64 returns the binary payload of a body.
+func decodeBase64(data []byte) ([]byte, error) {
+	raw := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(raw, data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding base64 body: %w", err)
+	}
+	return raw[:n], nil
+}
+
+// encodeBase64 returns the body of a binary payload.
+func encodeBase64(raw []byte) []byte {
+	data := make([]byte, base64.StdEncoding.EncodedLen(len(raw)))
+	base64.StdEncoding.Encode(data, raw)
+	return data
+}
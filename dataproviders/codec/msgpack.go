@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Msgpack encodes the bodies with MessagePack, the struct fields are named by their json tags so the
+// records decode as they do from JSON. It implements consumer.Codec.
+type Msgpack struct{}
+
+// NewMsgpack instances of a Msgpack codec.
+func NewMsgpack() *Msgpack {
+	return &Msgpack{}
+}
+
+// Decode unmarshals the base64 MessagePack body data into v.
+func (c *Msgpack) Decode(data []byte, v interface{}) error {
+	raw, err := decodeBase64(data)
+	if err != nil {
+		return err
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(raw))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("error decoding msgpack body: %w", err)
+	}
+	return nil
+}
+
+// Encode marshals v into a base64 MessagePack body.
+func (c *Msgpack) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, fmt.Errorf("error encoding msgpack body: %w", err)
+	}
+	return encodeBase64(buf.Bytes()), nil
+}
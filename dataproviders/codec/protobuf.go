@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Protobuf encodes the bodies with protocol buffers, it implements consumer.Codec. A value that isn't
+// a proto.Message, as the records of the consumer, is converted through the JSON mapping of the messages
+// created by newMessage, so the fields of the proto schema match the json tags of the value by their names.
+type Protobuf struct {
+	newMessage func() proto.Message
+}
+
+// NewProtobuf instances of a Protobuf codec of the messages created by newMessage.
+func NewProtobuf(newMessage func() proto.Message) *Protobuf {
+	return &Protobuf{newMessage: newMessage}
+}
+
+// Decode unmarshals the base64 protobuf body data into v.
+func (c *Protobuf) Decode(data []byte, v interface{}) error {
+	raw, err := decodeBase64(data)
+	if err != nil {
+		return err
+	}
+	if m, ok := v.(proto.Message); ok {
+		return c.unmarshal(raw, m)
+	}
+	m := c.newMessage()
+	if err := c.unmarshal(raw, m); err != nil {
+		return err
+	}
+	js, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error converting protobuf body: %w", err)
+	}
+	return json.Unmarshal(js, v)
+}
+
+// Encode marshals v into a base64 protobuf body.
+func (c *Protobuf) Encode(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		js, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		m = c.newMessage()
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(js, m); err != nil {
+			return nil, fmt.Errorf("error converting to protobuf body: %w", err)
+		}
+	}
+	raw, err := proto.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding protobuf body: %w", err)
+	}
+	return encodeBase64(raw), nil
+}
+
+// unmarshal decodes the binary payload raw into m.
+func (c *Protobuf) unmarshal(raw []byte, m proto.Message) error {
+	if err := proto.Unmarshal(raw, m); err != nil {
+		return fmt.Errorf("error decoding protobuf body: %w", err)
+	}
+	return nil
+}
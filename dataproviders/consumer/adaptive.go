@@ -0,0 +1,34 @@
+package consumer
+
+import (
+	"time"
+)
+
+// throttled widens the interval between the receives of the queue after SQS throttled it, the
+// interval starts at base and doubles on every throttle up to max.
+func (q *queue) throttled(base, max time.Duration) time.Duration {
+	interval := 2 * time.Duration(q.interval.Load())
+	if interval < base {
+		interval = base
+	}
+	if interval > max {
+		interval = max
+	}
+	q.interval.Store(int64(interval))
+	return interval
+}
+
+// received narrows the interval between the receives of the queue after a successful receive, it's
+// halved until it drops below base and the queue is polled back at full speed.
+func (q *queue) received(base time.Duration) {
+	interval := time.Duration(q.interval.Load()) / 2
+	if interval < base {
+		interval = 0
+	}
+	q.interval.Store(int64(interval))
+}
+
+// pollInterval returns the wait before the next receive of the queue, zero when it isn't throttled.
+func (q *queue) pollInterval() time.Duration {
+	return time.Duration(q.interval.Load())
+}
@@ -0,0 +1,35 @@
+package consumer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"strconv"
+	"time"
+)
+
+// messageAttributes returns the string message attributes of msg along with the attributes of its
+// SNS notification, which take precedence. It's nil when there is none.
+func messageAttributes(msg *sqs.Message, sns map[string]string) map[string]string {
+	if len(msg.MessageAttributes) == 0 {
+		return sns
+	}
+	attributes := make(map[string]string, len(msg.MessageAttributes)+len(sns))
+	for name, attr := range msg.MessageAttributes {
+		if attr != nil && attr.StringValue != nil {
+			attributes[name] = *attr.StringValue
+		}
+	}
+	for name, value := range sns {
+		attributes[name] = value
+	}
+	return attributes
+}
+
+// sentTimestamp returns when the message was sent to the queue, the zero time when SQS didn't report it.
+func sentTimestamp(msg *sqs.Message) time.Time {
+	millis, err := strconv.ParseInt(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameSentTimestamp]), 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis).UTC()
+}
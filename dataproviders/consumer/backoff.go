@@ -0,0 +1,50 @@
+package consumer
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffBase = 100 * time.Millisecond
+	defaultBackoffMax  = 30 * time.Second
+)
+
+// backoff computes exponential delays with jitter between consecutive failures.
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	current time.Duration
+}
+
+// next doubles the delay up to the max and returns it with jitter, so several replicas don't retry in sync.
+func (b *backoff) next() time.Duration {
+	if b.current == 0 {
+		b.current = b.base
+	} else {
+		b.current *= 2
+	}
+	if b.current > b.max {
+		b.current = b.max
+	}
+	half := b.current / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// reset sets the delay back to the base after a success.
+func (b *backoff) reset() {
+	b.current = 0
+}
+
+// sleep waits for d, it returns false when ctx is done before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
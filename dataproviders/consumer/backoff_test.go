@@ -0,0 +1,36 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffNext(t *testing.T) {
+	b := &backoff{base: 100 * time.Millisecond, max: time.Second}
+	tests := []struct {
+		failure int
+		want    time.Duration
+	}{
+		{failure: 1, want: 100 * time.Millisecond},
+		{failure: 2, want: 200 * time.Millisecond},
+		{failure: 3, want: 400 * time.Millisecond},
+		{failure: 4, want: 800 * time.Millisecond},
+		{failure: 5, want: time.Second},
+		{failure: 6, want: time.Second},
+	}
+	for _, tt := range tests {
+		delay := b.next()
+		if b.current != tt.want {
+			t.Fatalf("failure %d: delay %v, want %v", tt.failure, b.current, tt.want)
+		}
+		// the jitter keeps the delay within the upper half
+		if delay < tt.want/2 || delay > tt.want {
+			t.Fatalf("failure %d: jittered delay %v out of [%v, %v]", tt.failure, delay, tt.want/2, tt.want)
+		}
+	}
+
+	b.reset()
+	if b.next(); b.current != b.base {
+		t.Fatalf("delay after reset %v, want the base %v", b.current, b.base)
+	}
+}
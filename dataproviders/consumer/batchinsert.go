@@ -0,0 +1,87 @@
+package consumer
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+)
+
+// batched is a message prepared by persistBatch, processMessage goes on from it without checking the
+// deduper or decoding the body again.
+type batched struct {
+	// duplicate is set when the deduper had already seen the message, it was deleted.
+	duplicate bool
+	// decoded is set when the body was decoded into records and attributes, or failed with decodeErr.
+	decoded    bool
+	records    []domain.Events
+	attributes map[string]string
+	decodeErr  error
+	// stored is the record inserted with the batch, nil when it's left to be inserted on its own.
+	stored *domain.Events
+}
+
+// persistBatch checks the received messages with the deduper and stores their events in a single insert,
+// so a duplicate never overwrites its stored event. The messages prepared are returned keyed by message ID.
+// The messages filtered out, to be dead-lettered, offloaded, malformed or with several records aren't
+// inserted with the batch but left to processMessage, and when the insert fails every event is inserted
+// on its own.
+func (s *SQSSource) persistBatch(ctx context.Context, q *queue, messages []*sqs.Message) map[string]*batched {
+	prepared := make(map[string]*batched, len(messages))
+	records := make([]*domain.Events, 0, len(messages))
+	for _, msg := range messages {
+		retry := s.retryOf(msg)
+		if !s.accepts(msg) || s.exceededRetries(retry) {
+			continue
+		}
+		b := &batched{duplicate: s.duplicate(ctx, q, msg)}
+		prepared[aws.StringValue(msg.MessageId)] = b
+		if b.duplicate || msg.Body == nil {
+			continue
+		}
+		body := aws.StringValue(msg.Body)
+		if _, offloaded := awssqs.ParsePointer(body); offloaded && s.payloads != nil {
+			continue
+		}
+		b.decoded = true
+		b.records, b.attributes, b.decodeErr = s.decode(body)
+		if b.decodeErr != nil || len(b.records) > 1 {
+			continue
+		}
+		b.stored = s.newRecord(aws.StringValue(msg.MessageId), b.records[0], retry, s.correlationID(msg, b.attributes))
+		records = append(records, b.stored)
+	}
+	if len(records) < 2 {
+		return unstored(prepared)
+	}
+	if err := s.repo.InsertBatch(ctx, records); err != nil {
+		s.log.Errorf("Error inserting batch of %d events, inserting them one by one: %v", len(records), err)
+		return unstored(prepared)
+	}
+	return prepared
+}
+
+// unstored drops the records of the prepared messages, so processMessage inserts them on its own.
+func unstored(prepared map[string]*batched) map[string]*batched {
+	for _, b := range prepared {
+		b.stored = nil
+	}
+	return prepared
+}
+
+// forgetPrepared removes a message prepared by persistBatch from the deduper, it won't be processed.
+func (s *SQSSource) forgetPrepared(msg *sqs.Message, prepared *batched) {
+	if prepared != nil && !prepared.duplicate {
+		s.forget(msg)
+	}
+}
+
+// forgetGroups removes from the deduper the prepared messages of groups.
+func (s *SQSSource) forgetGroups(groups [][]*sqs.Message, prepared map[string]*batched) {
+	for _, group := range groups {
+		for _, msg := range group {
+			s.forgetPrepared(msg, prepared[aws.StringValue(msg.MessageId)])
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package consumer
+
+import (
+	"context"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// failureRatio is the share of failed events of a window over which the batch size is lowered.
+const failureRatio = 0.1
+
+// receiveContext limits the receive to the adapted batch size, if any.
+func (s *SQSSource) receiveContext(ctx context.Context) context.Context {
+	if s.tuner == nil {
+		return ctx
+	}
+	return awssqs.WithReceiveLimit(ctx, s.tuner.current())
+}
+
+// batchTuner adapts the number of messages requested on each receive to the processing latency. Every
+// window of as many events as the current size is measured: the size grows by one while the average
+// latency stays within the target and is halved when it's over the target or the failures spike.
+type batchTuner struct {
+	target time.Duration
+	max    int32
+	size   atomic.Int32
+
+	mu       sync.Mutex
+	window   int32
+	elapsed  time.Duration
+	failures int32
+}
+
+// newBatchTuner creates a tuner that starts from a single message and grows up to max.
+func newBatchTuner(max int, target time.Duration) *batchTuner {
+	t := &batchTuner{target: target, max: int32(max)}
+	t.size.Store(1)
+	return t
+}
+
+// current returns the number of messages to request on the next receive.
+func (t *batchTuner) current() int {
+	return int(t.size.Load())
+}
+
+// observe records the latency of an event, it reports the new size when the window ended and changed it.
+func (t *batchTuner) observe(elapsed time.Duration, failed bool) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.window++
+	t.elapsed += elapsed
+	if failed {
+		t.failures++
+	}
+	size := t.size.Load()
+	if t.window < size {
+		return 0, false
+	}
+
+	next := size
+	average := t.elapsed / time.Duration(t.window)
+	switch {
+	case average > t.target || float64(t.failures) > failureRatio*float64(t.window):
+		next = size / 2
+		if next < 1 {
+			next = 1
+		}
+	case size < t.max:
+		next = size + 1
+	}
+	t.window, t.elapsed, t.failures = 0, 0, 0
+	if next == size {
+		return 0, false
+	}
+	t.size.Store(next)
+	return int(next), true
+}
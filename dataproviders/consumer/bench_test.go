@@ -0,0 +1,93 @@
+package consumer
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+// insertLatency is the round-trip simulated by slowStore on every insert.
+const insertLatency = 200 * time.Microsecond
+
+// slowStore is a MemoryStore whose inserts take a database round-trip.
+type slowStore struct {
+	*testutil.MemoryStore
+}
+
+func (s slowStore) Insert(ctx context.Context, events *domain.Events) error {
+	time.Sleep(insertLatency)
+	return s.MemoryStore.Insert(ctx, events)
+}
+
+func (s slowStore) InsertBatch(ctx context.Context, events []*domain.Events) error {
+	time.Sleep(insertLatency)
+	return s.MemoryStore.InsertBatch(ctx, events)
+}
+
+// benchmarkConsume consumes b.N messages acking every event.
+func benchmarkConsume(b *testing.B, opts ...Option) {
+	fake := testutil.NewFakeSQS()
+	for i := 0; i < b.N; i++ {
+		fake.Enqueue(`{"id":"`+strconv.Itoa(i)+`","message":"hello"}`, nil)
+	}
+	s := newTestSource(b, slowStore{testutil.NewMemoryStore()}, []awssqs.Client{fake}, opts...)
+
+	b.ResetTimer()
+	events := s.Consume(context.Background())
+	for i := 0; i < b.N; i++ {
+		if err := s.Processed(nextEvent(b, events)); err != nil {
+			b.Fatalf("Processed: %v", err)
+		}
+	}
+	b.StopTimer()
+	closeSource(b, s)
+}
+
+func BenchmarkConsume(b *testing.B) {
+	b.Run("sequential", func(b *testing.B) {
+		benchmarkConsume(b, WithWorkers(1))
+	})
+	b.Run("pool", func(b *testing.B) {
+		benchmarkConsume(b, WithWorkers(8))
+	})
+}
+
+// benchmarkInsert consumes b.N messages received in batches of up to 10, as SQS delivers them,
+// acking every event.
+func benchmarkInsert(b *testing.B, opts ...Option) {
+	fake := testutil.NewFakeSQS()
+	s := newTestSource(b, slowStore{testutil.NewMemoryStore()}, []awssqs.Client{fake}, opts...)
+
+	b.ResetTimer()
+	events := s.Consume(context.Background())
+	for i := 0; i < b.N; i += awssqs.MaxReceiveMessages {
+		n := b.N - i
+		if n > awssqs.MaxReceiveMessages {
+			n = awssqs.MaxReceiveMessages
+		}
+		for j := 0; j < n; j++ {
+			fake.Enqueue(`{"id":"`+strconv.Itoa(i+j)+`","message":"hello"}`, nil)
+		}
+		for j := 0; j < n; j++ {
+			if err := s.Processed(nextEvent(b, events)); err != nil {
+				b.Fatalf("Processed: %v", err)
+			}
+		}
+	}
+	b.StopTimer()
+	closeSource(b, s)
+}
+
+func BenchmarkInsert(b *testing.B) {
+	b.Run("single", func(b *testing.B) {
+		benchmarkInsert(b, WithWorkers(1))
+	})
+	b.Run("batch", func(b *testing.B) {
+		benchmarkInsert(b, WithWorkers(1), WithBatchInsert())
+	})
+}
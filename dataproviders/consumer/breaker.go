@@ -0,0 +1,44 @@
+package consumer
+
+import (
+	"errors"
+	"github.com/sony/gobreaker"
+	"time"
+)
+
+// newBreaker returns the circuit breaker of the handler in Run, it opens after failures consecutive
+// failures and pauses the intake for cooldown. Then it half-opens resuming the intake, and it closes
+// once a receive batch of events is handled without failures. The breaker only resumes the intake it
+// paused itself.
+func (s *SQSSource) newBreaker(failures int, cooldown time.Duration) *gobreaker.CircuitBreaker {
+	var cb *gobreaker.CircuitBreaker
+	cb = gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        "consumer",
+		MaxRequests: uint32(s.maxMessages),
+		Timeout:     cooldown,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= uint32(failures)
+		},
+		OnStateChange: func(_ string, from, to gobreaker.State) {
+			s.log.Warnf("Circuit breaker of the handler changed from %s to %s", from, to)
+			if to == gobreaker.StateOpen {
+				if s.pause() {
+					s.breakerPaused.Store(true)
+				}
+				// the breaker only half-opens when its state is read after the cooldown
+				time.AfterFunc(cooldown, func() { cb.State() })
+				return
+			}
+			// a consumer paused by the caller stays paused
+			if s.breakerPaused.CompareAndSwap(true, false) {
+				s.Resume()
+			}
+		},
+	})
+	return cb
+}
+
+// rejectedByBreaker reports whether the event wasn't handled because the circuit breaker is open.
+func rejectedByBreaker(err error) bool {
+	return errors.Is(err, gobreaker.ErrOpenState) || errors.Is(err, gobreaker.ErrTooManyRequests)
+}
@@ -0,0 +1,55 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+// breakerCooldown is the cooldown of the breakers of the tests.
+const breakerCooldown = 20 * time.Millisecond
+
+// trip opens the breaker of s with a failure of the handler.
+func trip(t *testing.T, s *SQSSource) {
+	t.Helper()
+	_, _ = s.breaker.Execute(func() (interface{}, error) { return nil, errors.New("handler failed") })
+	if state := s.breaker.State(); state != gobreaker.StateOpen {
+		t.Fatalf("breaker %s after a failure, want open", state)
+	}
+}
+
+func TestBreakerPausesUntilHalfOpen(t *testing.T) {
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{testutil.NewFakeSQS()}, WithCircuitBreaker(1, breakerCooldown))
+
+	trip(t, s)
+	if !s.Paused() {
+		t.Fatal("the open breaker didn't pause the intake")
+	}
+	eventually(t, "the intake resumed", func() bool { return !s.Paused() })
+	if state := s.breaker.State(); state != gobreaker.StateHalfOpen {
+		t.Fatalf("breaker %s after the cooldown, want half-open", state)
+	}
+}
+
+func TestBreakerKeepsCallerPause(t *testing.T) {
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{testutil.NewFakeSQS()}, WithCircuitBreaker(1, breakerCooldown))
+
+	s.Pause()
+	trip(t, s)
+	eventually(t, "the breaker half-open", func() bool { return s.breaker.State() == gobreaker.StateHalfOpen })
+	if !s.Paused() {
+		t.Fatal("the breaker resumed a consumer paused by the caller")
+	}
+
+	// once the caller resumes, the breaker pauses and resumes the intake again
+	s.Resume()
+	trip(t, s)
+	if !s.Paused() {
+		t.Fatal("the open breaker didn't pause the intake")
+	}
+	eventually(t, "the intake resumed", func() bool { return !s.Paused() })
+}
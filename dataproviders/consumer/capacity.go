@@ -0,0 +1,39 @@
+package consumer
+
+import "context"
+
+// waitCapacity blocks the receives while the max in-flight events weren't processed yet, so every
+// message is acked on its own and the next receive follows the ack rate of the downstream instead of
+// waiting for the whole batch. It reports false when ctx is done or the consumer is closed first.
+func (s *SQSSource) waitCapacity(ctx context.Context) bool {
+	for {
+		s.capacityMu.Lock()
+		if s.counters.inFlight.Load() < int64(s.maxInFlight) {
+			s.capacityMu.Unlock()
+			return true
+		}
+		if s.capacity == nil {
+			s.capacity = make(chan struct{})
+		}
+		capacity := s.capacity
+		s.capacityMu.Unlock()
+
+		select {
+		case <-capacity:
+		case <-ctx.Done():
+			return false
+		case <-s.done:
+			return false
+		}
+	}
+}
+
+// released wakes up the receives waiting for capacity, it's called once an in-flight event ended.
+func (s *SQSSource) released() {
+	s.capacityMu.Lock()
+	defer s.capacityMu.Unlock()
+	if s.capacity != nil {
+		close(s.capacity)
+		s.capacity = nil
+	}
+}
@@ -1,124 +1,1057 @@
 package consumer
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
-	"go.uber.org/zap"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+	"runtime/debug"
 	"service-worker-sqs-postgres/core/domain"
 	"service-worker-sqs-postgres/dataproviders/awssqs"
-	repository "service-worker-sqs-postgres/dataproviders/postgres/repository/events"
+	"service-worker-sqs-postgres/dataproviders/utils"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxVisibility is the max visibility timeout allowed by SQS.
+const maxVisibility = 12 * time.Hour
+
+// maxDeleteBatch is the number of acked messages that triggers a batch deletion.
+const maxDeleteBatch = 10
+
+// defaultEmptyPollDelay is waited after a receive without messages, on top of the SQS long polling.
+const defaultEmptyPollDelay = time.Second
+
+// correlationIDAttribute is the message attribute carrying the correlation id.
+const correlationIDAttribute = "correlation-id"
+
 // SQSSource event stream representation to SQS.
 type SQSSource struct {
-	sqs         *awssqs.ClientSQS
-	log         *zap.SugaredLogger
+	queues      []*queue
+	queuesByURL map[string]*queue
+	log         domain.Logger
 	maxMessages int
-	closed      bool
-	repo        repository.IEventRepository
+	bufferSize  int
+	closed      atomic.Bool
+	intakeMu    sync.Mutex
+	repo        EventStore
 	wg          sync.WaitGroup
+	done        chan struct{}
+	closeOnce   sync.Once
+	pauseMu     sync.Mutex
+	resume      chan struct{}
+	workers     int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	emptyDelay  time.Duration
+	maxRetries  int
+	dlq         awssqs.Client
+	batchDelete time.Duration
+	pendingMu   sync.Mutex
+	snsUnwrap   bool
+	malformed   MalformedAction
+	idempotent  bool
+
+	leaveOnError bool
+	retryPolicy  RetryPolicy
+	batchInsert  bool
+	retention    time.Duration
+	payloads     awssqs.PayloadStore
+	filter       Filter
+	middlewares  []Middleware
+	keepFiltered bool
+	delayedRetry bool
+	attemptKeep  int
+	batchTarget  time.Duration
+	tuner        *batchTuner
+	deliveryMode DeliveryMode
+	dryRun       bool
+	deduper      Deduper
+	codec        Codec
+	onReceive    ReceiveHook
+	onComplete   CompleteHook
+	sampling     logSampling
+	pollLog      domain.Logger
+
+	polling        atomic.Int32
+	receiving      atomic.Int32
+	draining       atomic.Bool
+	staleness      time.Duration
+	processTimeout time.Duration
+	depthInterval  time.Duration
+	deadlinesMu    sync.Mutex
+	deadlines      map[*domain.Event]*deadline
+
+	inFlightWarning int
+	maxInFlight     int
+	capacityMu      sync.Mutex
+	capacity        chan struct{}
+	slowThreshold   time.Duration
+
+	rateLimit int
+	rateBurst int
+	limiter   *rate.Limiter
+
+	breakerFailures int
+	breakerCooldown time.Duration
+	breaker         *gobreaker.CircuitBreaker
+	// breakerPaused is set while the intake is paused by the open breaker, so it doesn't resume a
+	// consumer paused by the caller.
+	breakerPaused atomic.Bool
+
+	heartbeatInterval  time.Duration
+	heartbeatExtension time.Duration
+	heartbeatsMu       sync.Mutex
+	heartbeats         map[string]context.CancelFunc
+
+	groupsMu sync.Mutex
+	groups   map[string]chan struct{}
+
+	deliveriesMu sync.Mutex
+	deliveries   map[string]*delivery
+
+	counters counters
+	metrics  Metrics
+	tracer   trace.Tracer
 }
 
-// New return an event stream instance from SQS.
-func New(sqsClient *awssqs.ClientSQS, logger *zap.SugaredLogger, maxMessages int, repo repository.IEventRepository) (*SQSSource, error) {
-	return &SQSSource{
-		sqs:         sqsClient,
+// New return an event stream instance from SQS, the messages of all the queues are sent to the same stream.
+func New(sqsClients []awssqs.Client, logger domain.Logger, maxMessages int, repo EventStore, opts ...Option) (*SQSSource, error) {
+	if len(sqsClients) == 0 {
+		return nil, errors.New("at least one SQS client is required")
+	}
+	if maxMessages < 1 || maxMessages > awssqs.MaxReceiveMessages {
+		return nil, fmt.Errorf("max messages must be between 1 and %d, got %d", awssqs.MaxReceiveMessages, maxMessages)
+	}
+	s := &SQSSource{
+		queuesByURL: make(map[string]*queue, len(sqsClients)),
 		log:         logger,
 		maxMessages: maxMessages,
+		bufferSize:  maxMessages,
 		repo:        repo,
 		wg:          sync.WaitGroup{},
-	}, nil
+		done:        make(chan struct{}),
+		workers:     1,
+		backoffBase: defaultBackoffBase,
+		backoffMax:  defaultBackoffMax,
+		emptyDelay:  defaultEmptyPollDelay,
+		staleness:   defaultStaleness,
+		heartbeats:  make(map[string]context.CancelFunc),
+		deadlines:   make(map[*domain.Event]*deadline),
+		groups:      make(map[string]chan struct{}),
+		deliveries:  make(map[string]*delivery),
+		malformed:   MalformedLeave,
+		metrics:     noMetrics{},
+		tracer:      trace.NewNoopTracerProvider().Tracer(tracerName),
+	}
+	for _, client := range sqsClients {
+		if _, ok := s.queuesByURL[client.URL()]; ok {
+			return nil, fmt.Errorf("queue %s is consumed more than once", client.URL())
+		}
+		q := &queue{name: queueName(client.URL()), client: client}
+		s.queues = append(s.queues, q)
+		s.queuesByURL[client.URL()] = q
+	}
+	// by default every queue has room for a receive batch in-flight
+	s.maxInFlight = maxMessages * len(s.queues)
+	s.deliveryMode = AtLeastOnce
+	s.codec = JSONCodec{}
+	s.sampling = logSampling{interval: defaultSamplingInterval, first: defaultSamplingFirst, thereafter: defaultSamplingThereafter}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.bufferSize < 1 {
+		return nil, fmt.Errorf("buffer size must be greater than 0, got %d", s.bufferSize)
+	}
+	if s.maxInFlight < 1 {
+		return nil, fmt.Errorf("max in-flight must be greater than 0, got %d", s.maxInFlight)
+	}
+	if s.workers < 1 {
+		return nil, fmt.Errorf("workers must be greater than 0, got %d", s.workers)
+	}
+	if s.backoffBase <= 0 || s.backoffMax < s.backoffBase {
+		return nil, fmt.Errorf("invalid backoff: base %v must be positive and not greater than max %v", s.backoffBase, s.backoffMax)
+	}
+
+	if s.maxRetries < 0 {
+		return nil, fmt.Errorf("max retries must not be negative, got %d", s.maxRetries)
+	}
+	if s.batchDelete < 0 {
+		return nil, fmt.Errorf("batch delete interval must not be negative, got %v", s.batchDelete)
+	}
+	if s.heartbeatInterval < 0 || (s.heartbeatInterval > 0 && (s.heartbeatExtension < s.heartbeatInterval || s.heartbeatExtension > maxVisibility)) {
+		return nil, fmt.Errorf("invalid heartbeat: extension %v must be between the interval %v and %v", s.heartbeatExtension, s.heartbeatInterval, maxVisibility)
+	}
+	if s.codec == nil {
+		return nil, errors.New("codec is required to decode the messages")
+	}
+	if s.deliveryMode != AtLeastOnce && s.deliveryMode != AtMostOnce {
+		return nil, fmt.Errorf("unknown delivery mode %q", s.deliveryMode)
+	}
+	switch s.malformed {
+	case MalformedLeave, MalformedDrop:
+	case MalformedDLQ:
+		if s.dlq == nil {
+			return nil, fmt.Errorf("malformed action %q requires a DLQ", s.malformed)
+		}
+	default:
+		return nil, fmt.Errorf("unknown malformed action %q", s.malformed)
+	}
+	if s.emptyDelay < 0 {
+		return nil, fmt.Errorf("empty poll delay must not be negative, got %v", s.emptyDelay)
+	}
+	if s.staleness <= 0 {
+		return nil, fmt.Errorf("staleness must be positive, got %v", s.staleness)
+	}
+	if s.batchTarget < 0 {
+		return nil, fmt.Errorf("adaptive batch target must not be negative, got %v", s.batchTarget)
+	}
+	if s.batchTarget > 0 {
+		s.tuner = newBatchTuner(s.maxMessages, s.batchTarget)
+	}
+	if s.attemptKeep < 0 {
+		return nil, fmt.Errorf("attempt history must not be negative, got %d", s.attemptKeep)
+	}
+	if s.retention < 0 {
+		return nil, fmt.Errorf("retention must not be negative, got %v", s.retention)
+	}
+	if s.depthInterval < 0 {
+		return nil, fmt.Errorf("depth interval must not be negative, got %v", s.depthInterval)
+	}
+	if s.batchInsert && s.idempotent {
+		return nil, errors.New("batch insert can't be used with idempotency")
+	}
+	if s.slowThreshold < 0 {
+		return nil, fmt.Errorf("slow threshold must not be negative, got %v", s.slowThreshold)
+	}
+	if s.processTimeout < 0 {
+		return nil, fmt.Errorf("process timeout must not be negative, got %v", s.processTimeout)
+	}
+	if s.rateLimit < 0 || (s.rateLimit > 0 && s.rateBurst < 1) {
+		return nil, fmt.Errorf("invalid rate limit: %d messages per second with burst %d", s.rateLimit, s.rateBurst)
+	}
+	if s.rateLimit > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(s.rateLimit), s.rateBurst)
+	}
+	if s.breakerFailures < 0 || (s.breakerFailures > 0 && s.breakerCooldown <= 0) {
+		return nil, fmt.Errorf("invalid circuit breaker: %d failures with cooldown %v", s.breakerFailures, s.breakerCooldown)
+	}
+	if s.breakerFailures > 0 {
+		s.breaker = s.newBreaker(s.breakerFailures, s.breakerCooldown)
+	}
+	if s.sampling.first < 0 || s.sampling.thereafter < 0 || (s.sampling.first > 0 && s.sampling.interval <= 0) {
+		return nil, fmt.Errorf("invalid log sampling: first %d and thereafter %d per %v", s.sampling.first, s.sampling.thereafter, s.sampling.interval)
+	}
+	s.pollLog = s.log
+	if s.sampling.first > 0 {
+		s.pollLog = newSampledLogger(s.log, s.sampling)
+	}
+	if s.dryRun {
+		s.enableDryRun()
+	}
+
+	return s, nil
 }
 
-// Consume opens a channel and sends entities created from SQS messages.
-func (s *SQSSource) Consume() <-chan *domain.Event {
-	out := make(chan *domain.Event, s.maxMessages)
+// Consume opens a channel and sends entities created from SQS messages, every queue is polled on its own.
+// The polling stops when ctx is cancelled or the source is closed, the in-flight
+// events are drained and then the channel is closed.
+func (s *SQSSource) Consume(ctx context.Context) <-chan *domain.Event {
+	out := make(chan *domain.Event, s.bufferSize)
+	ctx, cancel := context.WithCancel(ctx)
 	go func() {
-		for {
-			if s.closed {
-				break
-			}
-			messages, err := s.sqs.GetMessages()
-			if err != nil {
-				s.log.Errorf("Error getting messages from SQS: %v", err)
-				continue
-			}
-			if len(messages) == 0 {
-				s.log.Debug("No messages found from SQS")
-			}
-			for _, msg := range messages {
-				s.processMessage(msg, out)
-			}
-			s.wg.Wait()
+		select {
+		case <-s.done:
+		case <-ctx.Done():
 		}
-		close(out)
+		cancel()
+	}()
+	jobs := make(chan job)
+	var workers sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range jobs {
+				for _, msg := range job.messages {
+					if err := s.processMessage(ctx, job.queue, msg, job.prepared[aws.StringValue(msg.MessageId)], out); err != nil {
+						s.log.Errorf("Error processing message from SQS: %v", err)
+					}
+				}
+			}
+		}()
+	}
+	if s.batchDelete > 0 {
+		go s.flushPeriodically(ctx)
+	}
+	if s.retention > 0 {
+		go s.purgePeriodically(ctx)
+	}
+	if s.depthInterval > 0 {
+		go s.reportDepthPeriodically(ctx)
+	}
+	var pollers sync.WaitGroup
+	for _, q := range s.queues {
+		pollers.Add(1)
+		s.polling.Add(1)
+		go func(q *queue) {
+			defer pollers.Done()
+			defer s.polling.Add(-1)
+			s.poll(ctx, q, jobs)
+		}(q)
+	}
+	go func() {
+		defer close(out)
+		defer cancel()
+		pollers.Wait()
+		s.log.Infof("Stopping SQS consumer: %v", ctx.Err())
+		close(jobs)
+		workers.Wait()
+		s.drain(out)
+		s.wg.Wait()
 	}()
 
 	return out
 }
 
-// processMessage read message in queue.
-func (s *SQSSource) processMessage(msg *sqs.Message, out chan *domain.Event) {
-	var records domain.Events
-	err := json.Unmarshal([]byte(*msg.Body), &records)
+// poll receives the messages of a queue and hands them to the workers until ctx is done or the source is closed.
+// Every message is acked on its own, so the next receive doesn't wait for the previous batch but only
+// for room among the max in-flight events.
+func (s *SQSSource) poll(ctx context.Context, q *queue, jobs chan<- job) {
+	retry := &backoff{base: s.backoffBase, max: s.backoffMax}
+	for !s.isClosed() && ctx.Err() == nil {
+		if !s.waitResumed(ctx) || !s.waitCapacity(ctx) {
+			return
+		}
+		if interval := q.pollInterval(); interval > 0 && !sleep(ctx, interval) {
+			return
+		}
+		s.receive(ctx, q, retry, jobs)
+	}
+}
+
+// receive runs a receive of the poll loop of q and dispatches its messages. A Drain waits for the
+// receives in progress, so the messages they return are processed too.
+func (s *SQSSource) receive(ctx context.Context, q *queue, retry *backoff, jobs chan<- job) {
+	s.receiving.Add(1)
+	defer s.receiving.Add(-1)
+	if s.draining.Load() {
+		return
+	}
+	messages, err := q.client.GetMessages(s.receiveContext(ctx))
 	if err != nil {
-		s.log.Errorf("Error processing message from SQS: %v", err)
+		if ctx.Err() == nil {
+			var delay time.Duration
+			switch {
+			case errors.Is(err, awssqs.ErrThrottled):
+				// the wait is the poll interval, it stays wide for the next receives too
+				interval := q.throttled(s.backoffBase, s.backoffMax)
+				s.pollLog.Warnf("SQS throttled the receive of queue %s, polling every %v: %v", q.name, interval, err)
+			case errors.Is(err, awssqs.ErrQueueNotFound):
+				// the queue may be created again, but not within the backoff of a transient failure
+				delay = s.backoffMax
+				s.pollLog.Errorf("SQS queue %s doesn't exist, retrying in %v: %v", q.name, delay, err)
+			default:
+				delay = retry.next()
+				s.pollLog.Errorf("Error getting messages from SQS queue %s, retrying in %v: %v", q.name, delay, err)
+			}
+			s.metrics.ReceiveError(q.name)
+			sleep(ctx, delay)
+		}
 		return
 	}
-	retry := "0"
-	val, ok := msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]
-	if ok {
-		retry = *val
+	retry.reset()
+	q.received(s.backoffBase)
+	s.countReceived(q, len(messages))
+	s.counters.lastReceive.Store(time.Now().UnixNano())
+	if len(messages) == 0 {
+		s.pollLog.Debugf("No messages found from SQS queue %s", q.name)
+		sleep(ctx, s.emptyDelay)
+		return
+	}
+	s.counters.lastMessage.Store(time.Now().UnixNano())
+	if messages = s.discardIncomplete(q, messages); len(messages) == 0 {
+		return
+	}
+	var prepared map[string]*batched
+	if s.batchInsert {
+		prepared = s.persistBatch(ctx, q, messages)
 	}
+	s.dispatch(ctx, q, messages, prepared, jobs)
+}
 
-	logger := s.log.With("retry", retry)
-	logger.Infof("Step 1 - Start to process SQS event")
+// dispatch hands the received messages to the workers, every message is tracked
+// as in-flight from here until it's processed or discarded. The messages of the same
+// FIFO group go in order to a single worker. The prepared messages not dispatched are forgotten by the deduper.
+func (s *SQSSource) dispatch(ctx context.Context, q *queue, messages []*sqs.Message, prepared map[string]*batched, jobs chan<- job) {
+	groups := splitByGroup(messages)
+	for i, group := range groups {
+		if !s.track(len(group)) {
+			s.forgetGroups(groups[i:], prepared)
+			return
+		}
+		select {
+		case jobs <- job{queue: q, messages: group, prepared: prepared}:
+		case <-ctx.Done():
+			s.wg.Add(-len(group))
+			s.forgetGroups(groups[i:], prepared)
+			return
+		}
+	}
+}
 
-	eventDB := &domain.Events{
-		ID:      *msg.MessageId,
-		Message: records.Message,
-		Date:    time.Now().Format(time.RFC3339),
+// track adds n in-flight messages to the wait group unless the source is closed, so no message is
+// added once Close is waiting for the in-flight ones.
+func (s *SQSSource) track(n int) bool {
+	s.intakeMu.Lock()
+	defer s.intakeMu.Unlock()
+	if s.isClosed() {
+		return false
 	}
+	s.wg.Add(n)
+	return true
+}
 
-	if err = s.repo.Insert(eventDB); err != nil {
-		logger.Errorf("Error inserting message: %v", err)
+// processMessage read message in queue. The event is only produced once it's stored, when it can't be
+// stored the message is left in the queue and the error is returned. A panic is recovered and the message
+// is left in the queue too, so it's visible again after the visibility timeout. prepared is the message
+// prepared by persistBatch, otherwise nil.
+func (s *SQSSource) processMessage(ctx context.Context, q *queue, msg *sqs.Message, prepared *batched, out chan *domain.Event) (err error) {
+	if s.limiter != nil && s.limiter.Wait(ctx) != nil {
+		s.forgetPrepared(msg, prepared)
+		s.wg.Done()
+		return nil
+	}
+	group := groupKey(q, msg)
+	if !s.lockGroup(ctx, group) {
+		s.forgetPrepared(msg, prepared)
+		s.wg.Done()
+		return nil
+	}
+	retry := s.retryOf(msg)
+
+	spanCtx, span := s.startSpan(ctx, q, msg, retry)
+	produced := false
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Errorf("Panic processing message %s: %v\n%s", aws.StringValue(msg.MessageId), r, debug.Stack())
+			err = fmt.Errorf("panic processing message: %v", r)
+		}
+		if !produced {
+			endSpan(spanCtx, err)
+			s.unlockGroup(group)
+			s.wg.Done()
+		}
+	}()
+
+	if !s.accepts(msg) {
+		s.skip(ctx, q, msg)
+		return nil
+	}
+
+	if s.exceededRetries(retry) {
+		s.deadLetter(ctx, q, msg, retry)
+		return nil
+	}
+
+	if prepared != nil && prepared.duplicate || prepared == nil && s.duplicate(ctx, q, msg) {
+		return nil
+	}
+	defer func() {
+		if !produced {
+			s.forget(msg)
+		}
+	}()
+
+	if msg.Body == nil {
+		span.RecordError(errEmptyBody)
+		s.handleMalformed(ctx, q, msg, errEmptyBody)
+		return nil
+	}
+	var records []domain.Events
+	var attributes map[string]string
+	var decodeErr error
+	if prepared != nil && prepared.decoded {
+		records, attributes, decodeErr = prepared.records, prepared.attributes, prepared.decodeErr
+	} else {
+		body, err := s.payload(ctx, msg)
+		if err != nil {
+			s.countFailed(q)
+			return fmt.Errorf("error getting payload of message %s, the message is left to be redelivered: %w", aws.StringValue(msg.MessageId), err)
+		}
+		records, attributes, decodeErr = s.decode(body)
+	}
+	if decodeErr != nil {
+		span.RecordError(decodeErr)
+		s.handleMalformed(ctx, q, msg, decodeErr)
+		return nil
+	}
+	if len(records) > 1 {
+		return s.processRecords(ctx, q, msg, records, attributes, retry, spanCtx, out, &produced)
+	}
+
+	var stored *domain.Events
+	if prepared != nil {
+		stored = prepared.stored
+	}
+	eventDB := stored
+	if eventDB == nil {
+		eventDB = s.newRecord(aws.StringValue(msg.MessageId), records[0], retry, s.correlationID(msg, attributes))
+	}
+	correlationID := eventDB.CorrelationID
+	logger := s.messageLogger(q, msg, attributes, retry, correlationID)
+	logger.Infof("Step 1 - Start to process SQS event")
+
+	var processed bool
+	if stored == nil {
+		var persistErr error
+		if processed, persistErr = s.persist(ctx, eventDB); persistErr != nil {
+			s.countFailed(q)
+			return fmt.Errorf("error inserting event %s, the message is left to be redelivered: %w", eventDB.ID, persistErr)
+		}
+	}
+	if processed {
+		logger.Infof("Event %s was already processed, deleting the duplicated message", eventDB.ID)
+		if err := q.client.DeleteMessage(ctx, msg); err != nil {
+			logger.Errorf("error deleting of sqs message. %v", err)
+		}
+		return nil
+	}
+	logger.Infof("Step 2 - Event saved in postgres")
+	if err := s.deleteBeforeProducing(ctx, q, msg); err != nil {
+		return err
 	}
-	logger.Info("Step 2 - Event saved in postgres")
 
 	event := &domain.Event{
-		ID:            *msg.MessageId,
+		ID:            aws.StringValue(msg.MessageId),
 		Retry:         retry,
-		Records:       records,
+		Queue:         q.client.URL(),
+		CorrelationID: correlationID,
+		Records:       records[0],
+		Attributes:    messageAttributes(msg, attributes),
 		OriginalEvent: msg,
-		Log:           s.log,
+		Log:           logger,
+		StartedAt:     time.Now(),
+		Context:       spanCtx,
+
+		SentTimestamp:  sentTimestamp(msg),
+		MessageGroupID: groupOf(msg),
+	}
+	s.startHeartbeat(ctx, q, logger, msg)
+	s.trackDeadline(event)
+	s.updateStatus(event.ID, domain.StatusProcessing, nil)
+	s.runReceiveHook(event)
+	select {
+	case out <- event:
+		produced = true
+		s.armDeadline(event)
+		s.counters.emitted.Add(1)
+		if inFlight := s.counters.inFlight.Add(1); s.inFlightWarning > 0 && inFlight >= int64(s.inFlightWarning) {
+			logger.Warnf("%d events in-flight waiting to be processed, the downstream may be stalled", inFlight)
+		}
+		logger.Infof("Step 3 - Event produced for ID = %s)", event.ID)
+	case <-ctx.Done():
+		s.stopHeartbeat(event.ID)
+		s.claim(event)
+		logger.Warnf("Event %s not produced, the consumer is shutting down", event.ID)
+	}
+	return nil
+}
+
+// payload returns the body of a message, downloading it when it was offloaded with a claim check.
+func (s *SQSSource) payload(ctx context.Context, msg *sqs.Message) (string, error) {
+	body := aws.StringValue(msg.Body)
+	if s.payloads == nil {
+		return body, nil
+	}
+	return awssqs.ResolvePayload(ctx, s.payloads, body)
+}
+
+// errEmptyBody is the decode error of a message without body.
+var errEmptyBody = errors.New("message without body")
+
+// discardIncomplete drops the messages without ID, they can't be tracked so they're left in the queue.
+func (s *SQSSource) discardIncomplete(q *queue, messages []*sqs.Message) []*sqs.Message {
+	valid := messages[:0]
+	for _, msg := range messages {
+		if msg == nil || aws.StringValue(msg.MessageId) == "" {
+			s.countFailed(q)
+			s.log.Errorf("Message without ID received from SQS queue %s, skipping it", q.name)
+			continue
+		}
+		valid = append(valid, msg)
+	}
+	return valid
+}
+
+// retryOf parses the receive count attribute of a message, it's 0 when the attribute is missing or
+// isn't a number.
+func (s *SQSSource) retryOf(msg *sqs.Message) int {
+	carried := 0
+	if attr, ok := msg.MessageAttributes[retriesAttribute]; ok {
+		if n, err := strconv.Atoi(aws.StringValue(attr.StringValue)); err == nil && n > 0 {
+			carried = n
+		}
+	}
+	val, ok := msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]
+	if !ok || val == nil {
+		return carried
+	}
+	count, err := strconv.Atoi(*val)
+	if err != nil {
+		s.log.Warnf("Message %s has an invalid receive count %q, taken as 0", aws.StringValue(msg.MessageId), *val)
+		return carried
+	}
+	return carried + count
+}
+
+// newRecord creates the record of an event to be stored.
+func (s *SQSSource) newRecord(id string, record domain.Events, retry int, correlationID string) *domain.Events {
+	return &domain.Events{
+		ID:            id,
+		Message:       record.Message,
+		Date:          time.Now().UTC(),
+		Status:        domain.StatusReceived,
+		Retry:         retry,
+		CorrelationID: correlationID,
 	}
-	s.wg.Add(1)
-	logger.Infof("Step 3 - Event produced for ID = %s)", event.ID)
-	out <- event
+}
+
+// persist stores the event, with idempotency enabled it reports true without storing it when
+// the event was already processed.
+func (s *SQSSource) persist(ctx context.Context, event *domain.Events) (bool, error) {
+	if s.idempotent {
+		return s.repo.InsertIfNotProcessed(ctx, event)
+	}
+	return false, s.repo.Insert(ctx, event)
 }
 
 // Processed notify that event of consolidate file was processed.
-func (s *SQSSource) Processed(event *domain.Event) error {
+func (s *SQSSource) Processed(event *domain.Event) (err error) {
+	if !s.claim(event) {
+		return fmt.Errorf("error processing event %s: %w", event.ID, s.errUnclaimed())
+	}
 	defer s.wg.Done()
+	defer func() {
+		endSpan(event.Context, err)
+		s.completed(event, err)
+	}()
+	return s.settle(event, outcomeProcessed, 0, nil)
+}
+
+// settle ends an event with its outcome. The message of the event is deleted, released or rejected
+// once it's the last event of the message, with the worst outcome of the records of the message.
+func (s *SQSSource) settle(event *domain.Event, o outcome, visibility int, cause error) error {
 	logger := event.Log
+	s.recordAttempt(event, o, cause)
+	if event.OriginalEvent == nil {
+		// a replayed event has no message in the queue
+		if o == outcomeProcessed {
+			s.markProcessed(event.ID)
+		}
+		logger.Infof("Step 4 - Replayed event %s settled", event.ID)
+		return nil
+	}
+	q, ok := s.queueOf(event)
+	if !ok {
+		logger.Errorf("Event %s is from the unknown queue %s", event.ID, event.Queue)
+		return fmt.Errorf("unknown queue %s of event %s", event.Queue, event.ID)
+	}
+	msg, ok := event.OriginalEvent.(*sqs.Message)
+	if !ok {
+		logger.Warnf("Event isn't sqs message")
+		return nil
+	}
+	single := true
+	if d, ok := s.deliveryOf(msg); ok {
+		// The records are marked processed on their own, so only the failed ones are retried when idempotent.
+		if o == outcomeProcessed && !s.dryRun {
+			s.markProcessed(event.ID)
+		}
+		var last bool
+		if last, o, visibility, cause = d.settle(o, visibility, cause); !last {
+			logger.Infof("Step 4 - Event %s settled, the message waits for its other records", event.ID)
+			return nil
+		}
+		s.forgetDelivery(msg)
+		single = false
+	}
+	s.stopHeartbeat(aws.StringValue(msg.MessageId))
+	defer s.unlockGroup(groupKey(q, msg))
+	if s.dryRun || (o == outcomeRetry && s.deliveryMode == AtLeastOnce) {
+		// the message is delivered again, so it isn't a duplicate
+		s.forget(msg)
+	}
+	if s.dryRun {
+		logger.Infof("Step 4 - Dry run, sqs message left in the queue")
+		return nil
+	}
+	if s.deliveryMode == AtMostOnce && o != outcomeReject {
+		return s.settleDeleted(event, o, cause, single)
+	}
+	switch o {
+	case outcomeReject:
+		return s.rejectMessage(q, msg, logger, event.Retry, cause)
+	case outcomeRetry:
+		if s.delayedRetry {
+			return s.requeueMessage(q, msg, logger, event.Retry, visibility)
+		}
+		return s.releaseMessage(q, msg, logger, visibility)
+	}
+	if s.batchDelete > 0 {
+		return s.deleteLater(q, msg)
+	}
+	if err := q.client.DeleteMessage(context.Background(), msg); err != nil {
+		logger.Errorf("error deleting of sqs message. %v", err)
+		s.updateStatus(event.ID, domain.StatusFailed, err)
+		return err
+	}
+	logger.Infof("Step 4 - Successful deleted sqs message")
+	if single {
+		s.markProcessed(event.ID)
+	}
+	return nil
+}
 
-	if events, ok := event.OriginalEvent.(*sqs.Message); ok {
-		if err := s.sqs.DeleteMessage(events); err != nil {
-			logger.Errorf("error deleting of sqs message. %v", err)
-			return err
+// exceededRetries reports whether the receive count of a message is over the max retries,
+// zero max retries disables the check.
+func (s *SQSSource) exceededRetries(retry int) bool {
+	return s.maxRetries > 0 && retry > s.maxRetries
+}
+
+// correlationID returns the correlation id of a message from its correlation-id attribute, the SNS
+// attributes are looked up too. A new id is generated when the message doesn't carry one.
+func (s *SQSSource) correlationID(msg *sqs.Message, attributes map[string]string) string {
+	if attr, ok := msg.MessageAttributes[correlationIDAttribute]; ok && aws.StringValue(attr.StringValue) != "" {
+		return aws.StringValue(attr.StringValue)
+	}
+	if id := attributes[correlationIDAttribute]; id != "" {
+		return id
+	}
+	return utils.NewID()
+}
+
+// deadLetter moves a message to the dead-letter queue, when there is no one configured the message is only deleted.
+func (s *SQSSource) deadLetter(ctx context.Context, q *queue, msg *sqs.Message, retry int) {
+	logger := s.messageLogger(q, msg, nil, retry, "")
+	if s.dlq != nil {
+		if err := s.dlq.Forward(ctx, msg, map[string]string{"ReceiveCount": strconv.Itoa(retry)}); err != nil {
+			logger.Errorf("Error sending message %s to the DLQ: %v", aws.StringValue(msg.MessageId), err)
+			return
 		}
-		logger.Infof("Step 4 - Successful deleted sqs message")
+		s.countDeadLettered(q)
+		logger.Warnf("Message %s exceeded %d retries, moved to the DLQ", aws.StringValue(msg.MessageId), s.maxRetries)
+	} else {
+		logger.Warnf("Message %s exceeded %d retries and no DLQ is configured, discarding it", aws.StringValue(msg.MessageId), s.maxRetries)
+	}
+	if err := q.client.DeleteMessage(ctx, msg); err != nil {
+		logger.Errorf("error deleting of sqs message. %v", err)
+	}
+}
+
+// Nack notify that event couldn't be processed because of cause, the event is recorded as failed
+// and the message becomes visible right away to be retried.
+func (s *SQSSource) Nack(event *domain.Event, cause error) error {
+	return s.fail(event, cause, 0)
+}
+
+// leaveVisibility keeps the visibility timeout of a failed message, so it's retried once it expires.
+const leaveVisibility = -1
+
+// fail records the event as failed because of cause and releases it, the visibility of the message
+// is changed to visibility seconds unless it's leaveVisibility.
+func (s *SQSSource) fail(event *domain.Event, cause error, visibility int) error {
+	if !s.claim(event) {
+		return fmt.Errorf("error failing event %s: %w", event.ID, s.errUnclaimed())
+	}
+	defer s.wg.Done()
+	defer s.completed(event, cause)
+	defer endSpan(event.Context, cause)
+	s.updateStatus(event.ID, domain.StatusFailed, cause)
+	return s.settle(event, outcomeRetry, visibility, cause)
+}
+
+// releaseMessage changes the visibility of a failed message to visibility seconds, the visibility
+// timeout is kept when it's leaveVisibility.
+func (s *SQSSource) releaseMessage(q *queue, msg *sqs.Message, logger domain.Logger, visibility int) error {
+	if visibility == leaveVisibility {
+		logger.Infof("Step 4 - Left sqs message to be retried after the visibility timeout")
 		return nil
 	}
-	logger.Warnf("Event isn't sqs message")
+	if err := q.client.ChangeMessageVisibility(context.Background(), msg, visibility); err != nil {
+		logger.Errorf("error releasing of sqs message. %v", err)
+		return err
+	}
+	logger.Infof("Step 4 - Released sqs message to be retried")
 	return nil
 }
 
+// completed updates the counters and the metrics when an in-flight event ends, err is set when it failed.
+func (s *SQSSource) completed(event *domain.Event, err error) {
+	s.counters.inFlight.Add(-1)
+	s.released()
+	s.runCompleteHook(event, err)
+	elapsed := time.Since(event.StartedAt)
+	if s.slowThreshold > 0 && elapsed > s.slowThreshold {
+		event.Log.Warnf("Slow event %s with retry %d took %v, over the threshold of %v", event.ID, event.Retry, elapsed, s.slowThreshold)
+	}
+	if s.tuner != nil {
+		if size, changed := s.tuner.observe(elapsed, err != nil); changed {
+			s.log.Debugf("Receive batch size adapted to %d messages", size)
+		}
+	}
+	q, _ := s.queueOf(event)
+	if err != nil {
+		s.counters.failed.Add(1)
+		if q != nil {
+			q.counters.failed.Add(1)
+		}
+		s.metrics.MessageFailed(queueName(event.Queue))
+		return
+	}
+	s.counters.acked.Add(1)
+	if q != nil {
+		q.counters.acked.Add(1)
+	}
+	s.counters.lastProcessed.Store(time.Now().UnixNano())
+	s.metrics.MessageProcessed(queueName(event.Queue), elapsed)
+}
+
+// handleMalformed applies the malformed action to a message whose body couldn't be decoded.
+func (s *SQSSource) handleMalformed(ctx context.Context, q *queue, msg *sqs.Message, cause error) {
+	id := aws.StringValue(msg.MessageId)
+	s.countFailed(q)
+	switch s.malformed {
+	case MalformedDLQ:
+		if err := s.dlq.Forward(ctx, msg, map[string]string{"DecodeError": cause.Error()}); err != nil {
+			s.log.Errorf("Error sending malformed message %s to the DLQ: %v", id, err)
+			return
+		}
+		s.countDeadLettered(q)
+		s.log.Warnf("Malformed message %s moved to the DLQ: %v", id, cause)
+	case MalformedDrop:
+		s.log.Warnf("Malformed message %s discarded: %v", id, cause)
+	default:
+		s.log.Errorf("Error processing message from SQS: %v", cause)
+		return
+	}
+	if err := q.client.DeleteMessage(ctx, msg); err != nil {
+		s.log.Errorf("error deleting of sqs message. %v", err)
+	}
+}
+
 // Close the event stream.
-func (s *SQSSource) Close() error {
-	s.closed = true
-	s.wg.Wait()
+// The polling stops right away and the in-flight events are waited until ctx is done, when they
+// aren't processed in time an error is returned without waiting for them any longer.
+func (s *SQSSource) Close(ctx context.Context) error {
+	s.intakeMu.Lock()
+	s.closed.Store(true)
+	s.intakeMu.Unlock()
+	s.closeOnce.Do(func() { close(s.done) })
+	s.waitInFlight(ctx)
+	if err := ctx.Err(); err != nil {
+		stuck := s.counters.inFlight.Load()
+		s.log.Errorf("Error closing consumer, %d events in-flight weren't processed in time", stuck)
+		return fmt.Errorf("error closing consumer with %d events in-flight: %w", stuck, err)
+	}
+	return s.Flush(ctx)
+}
+
+// isClosed reports whether Close was called on the event stream.
+func (s *SQSSource) isClosed() bool {
+	return s.closed.Load()
+}
+
+// waitInFlight blocks until the produced events are processed or ctx is done.
+func (s *SQSSource) waitInFlight(ctx context.Context) {
+	processed := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(processed)
+	}()
+	select {
+	case <-processed:
+	case <-ctx.Done():
+	}
+}
+
+// drain releases the events left in the channel buffer that no reader took,
+// they aren't deleted so SQS delivers them again after the visibility timeout.
+func (s *SQSSource) drain(out chan *domain.Event) {
+	for {
+		select {
+		case event := <-out:
+			event.Log.Warnf("Event %s discarded on shutdown", event.ID)
+			if s.claim(event) {
+				s.counters.inFlight.Add(-1)
+				s.released()
+				s.wg.Done()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// deleteLater buffers an acked message to be deleted in the next batch, the batch is
+// flushed right away once it's full.
+func (s *SQSSource) deleteLater(q *queue, msg *sqs.Message) error {
+	s.pendingMu.Lock()
+	q.pending = append(q.pending, msg)
+	full := len(q.pending) >= maxDeleteBatch
+	s.pendingMu.Unlock()
+
+	if full {
+		return s.flushQueue(context.Background(), q)
+	}
 	return nil
 }
+
+// flushPeriodically deletes the buffered messages every batch interval, so the last
+// messages of a burst don't wait for a full batch.
+func (s *SQSSource) flushPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(s.batchDelete)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.Flush(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Flush deletes right away the acked messages buffered by WithBatchDelete instead of waiting for the batch
+// interval, the last error of the queues is returned. Close and Drain flush, so the acks of the last events
+// aren't lost. The batch inserts aren't buffered, they're stored before the events are produced.
+func (s *SQSSource) Flush(ctx context.Context) error {
+	var err error
+	for _, q := range s.queues {
+		if flushErr := s.flushQueue(ctx, q); flushErr != nil {
+			err = flushErr
+		}
+	}
+	return err
+}
+
+// flushQueue deletes the buffered messages of a queue, the messages failed are redelivered by SQS.
+func (s *SQSSource) flushQueue(ctx context.Context, q *queue) error {
+	s.pendingMu.Lock()
+	batch := q.pending
+	q.pending = nil
+	s.pendingMu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	err := q.client.DeleteMessageBatch(ctx, batch)
+	var batchErr *awssqs.BatchError
+	if err != nil && !errors.As(err, &batchErr) {
+		s.log.Errorf("error deleting batch of %d sqs messages. %v", len(batch), err)
+		return err
+	}
+	for _, msg := range batch {
+		id := aws.StringValue(msg.MessageId)
+		if batchErr != nil {
+			if _, failed := batchErr.Failed[id]; failed {
+				continue
+			}
+		}
+		s.markProcessed(id)
+	}
+	if err != nil {
+		s.log.Errorf("error deleting %d of %d sqs messages. %v", len(batchErr.Failed), len(batch), err)
+		return err
+	}
+	s.log.Infof("Step 4 - Successful deleted %d sqs messages", len(batch))
+	return nil
+}
+
+// updateStatus records the status of the event in the database, a failure is only logged
+// since the status is informative.
+func (s *SQSSource) updateStatus(id, status string, cause error) {
+	lastError := ""
+	if cause != nil {
+		lastError = cause.Error()
+	}
+	if err := s.repo.UpdateStatus(context.Background(), id, status, lastError); err != nil {
+		s.log.Errorf("Error updating status of event %s to %s: %v", id, status, err)
+	}
+}
+
+// recordAttempt appends the outcome of the event to its attempt history when it's kept, a failure
+// is only logged since the history is informative.
+func (s *SQSSource) recordAttempt(event *domain.Event, o outcome, cause error) {
+	if s.attemptKeep == 0 {
+		return
+	}
+	attempt := &domain.Attempt{EventID: event.ID, Retry: event.Retry, Outcome: domain.AttemptProcessed, At: time.Now().UTC()}
+	switch o {
+	case outcomeRetry:
+		attempt.Outcome = domain.AttemptRetried
+	case outcomeReject:
+		attempt.Outcome = domain.AttemptRejected
+	}
+	if cause != nil {
+		attempt.Error = cause.Error()
+	}
+	if err := s.repo.AddAttempt(context.Background(), attempt, s.attemptKeep); err != nil {
+		s.log.Errorf("Error recording attempt %d of event %s: %v", event.Retry, event.ID, err)
+	}
+}
+
+// markProcessed records in the database that the event was processed, a failure is only logged
+// since the message is already deleted.
+func (s *SQSSource) markProcessed(id string) {
+	if err := s.repo.MarkProcessed(context.Background(), id); err != nil {
+		s.log.Errorf("Error marking event %s as processed: %v", id, err)
+	}
+}
+
+// startHeartbeat extends the visibility of the message every heartbeat interval until its
+// events are processed or the consumer is closed.
+func (s *SQSSource) startHeartbeat(ctx context.Context, q *queue, logger domain.Logger, msg *sqs.Message) {
+	// in at-most-once mode the message was already deleted
+	if s.heartbeatInterval == 0 || s.deliveryMode == AtMostOnce {
+		return
+	}
+	id := aws.StringValue(msg.MessageId)
+	ctx, cancel := context.WithCancel(ctx)
+	s.heartbeatsMu.Lock()
+	s.heartbeats[id] = cancel
+	s.heartbeatsMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(s.heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := q.client.ChangeMessageVisibility(ctx, msg, int(s.heartbeatExtension.Seconds())); err != nil && ctx.Err() == nil {
+					logger.Warnf("Error extending visibility of message %s: %v", id, err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stopHeartbeat stops the visibility extension of the message, if any.
+func (s *SQSSource) stopHeartbeat(id string) {
+	s.heartbeatsMu.Lock()
+	cancel, ok := s.heartbeats[id]
+	delete(s.heartbeats, id)
+	s.heartbeatsMu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
@@ -0,0 +1,425 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.uber.org/zap"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/logging"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+// testTimeout bounds the waits of the tests, it's only reached when a test fails.
+const testTimeout = 5 * time.Second
+
+// testBody is the body of a message with a single valid record.
+const testBody = `{"id":"1","message":"hello"}`
+
+// testLogger discards the logs of the consumer.
+func testLogger() domain.Logger {
+	return logging.NewZap(zap.NewNop().Sugar())
+}
+
+// newTestSource creates a consumer of the fake queues storing its events in store, the empty
+// receives are retried right away so the tests don't wait for the default poll delay.
+func newTestSource(t testing.TB, store EventStore, queues []awssqs.Client, opts ...Option) *SQSSource {
+	t.Helper()
+	opts = append([]Option{WithEmptyPollDelay(time.Millisecond)}, opts...)
+	s, err := New(queues, testLogger(), awssqs.MaxReceiveMessages, store, opts...)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+// closeSource closes s and fails the test when the in-flight events don't end in time.
+func closeSource(t testing.TB, s *SQSSource) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+// nextEvent returns the next event of the stream.
+func nextEvent(t testing.TB, events <-chan *domain.Event) *domain.Event {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("event stream closed")
+		}
+		return event
+	case <-time.After(testTimeout):
+		t.Fatal("no event produced")
+	}
+	return nil
+}
+
+// noEvent fails the test when the stream produces an event within wait.
+func noEvent(t testing.TB, events <-chan *domain.Event, wait time.Duration) {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if ok {
+			t.Fatalf("unexpected event %s produced", event.ID)
+		}
+	case <-time.After(wait):
+	}
+}
+
+// eventually waits until cond holds.
+func eventually(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// drained waits until the event stream is closed.
+func drained(t testing.TB, events <-chan *domain.Event) {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("event stream not closed")
+		}
+	}
+}
+
+func TestConsumeClose(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithWorkers(4))
+
+	events := s.Consume(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+			defer cancel()
+			if err := s.Close(ctx); err != nil {
+				t.Errorf("Close: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	drained(t, events)
+	if !s.isClosed() {
+		t.Fatal("source isn't closed")
+	}
+	if err := s.Liveness(); err == nil {
+		t.Fatal("a closed source is live")
+	}
+}
+
+func TestCloseWithStalledReader(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	for i := 0; i < 5; i++ {
+		fake.Enqueue(testBody, nil)
+	}
+	// the buffer has room for a single event, so the workers block sending the others
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithBufferSize(1), WithWorkers(2))
+
+	events := s.Consume(context.Background())
+	eventually(t, "a blocked send", func() bool { return len(events) == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("Close took %v with a stalled reader", elapsed)
+	}
+	drained(t, events)
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted, the events discarded must be redelivered", deleted)
+	}
+}
+
+func TestCloseTimeoutWithUnackedEvent(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake})
+
+	events := s.Consume(context.Background())
+	nextEvent(t, events)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := s.Close(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close returned %v, want the deadline exceeded", err)
+	}
+	if !strings.Contains(err.Error(), "1 events in-flight") {
+		t.Fatalf("Close returned %q, want it to report the event in-flight", err)
+	}
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted, the unacked event must be redelivered", deleted)
+	}
+}
+
+// rawQueue delivers its messages untouched in the first receive, the next receives are the ones of
+// the fake queue.
+type rawQueue struct {
+	*testutil.FakeSQS
+	mu       sync.Mutex
+	messages []*sqs.Message
+}
+
+func (q *rawQueue) GetMessages(ctx context.Context) ([]*sqs.Message, error) {
+	q.mu.Lock()
+	messages := q.messages
+	q.messages = nil
+	q.mu.Unlock()
+	if messages != nil {
+		return messages, nil
+	}
+	return q.FakeSQS.GetMessages(ctx)
+}
+
+func TestMessagesWithNilFields(t *testing.T) {
+	tests := []struct {
+		name       string
+		msg        *sqs.Message
+		wantEvent  bool
+		wantFailed int64
+	}{
+		{name: "nil message", msg: nil, wantFailed: 1},
+		{name: "nil id", msg: &sqs.Message{ReceiptHandle: aws.String("handle"), Body: aws.String(testBody)}, wantFailed: 1},
+		{name: "nil body", msg: &sqs.Message{MessageId: aws.String("1"), ReceiptHandle: aws.String("handle")}, wantFailed: 1},
+		{name: "nil attributes", msg: &sqs.Message{MessageId: aws.String("1"), ReceiptHandle: aws.String("handle"), Body: aws.String(testBody)}, wantEvent: true},
+		{name: "nil attribute values", msg: &sqs.Message{
+			MessageId:     aws.String("1"),
+			ReceiptHandle: aws.String("handle"),
+			Body:          aws.String(testBody),
+			Attributes: map[string]*string{
+				sqs.MessageSystemAttributeNameApproximateReceiveCount: nil,
+				sqs.MessageSystemAttributeNameSentTimestamp:           nil,
+				sqs.MessageSystemAttributeNameMessageGroupId:          nil,
+			},
+			MessageAttributes: map[string]*sqs.MessageAttributeValue{"trace-id": nil, "source": {DataType: aws.String("String")}},
+		}, wantEvent: true},
+		{name: "nil receipt handle", msg: &sqs.Message{MessageId: aws.String("1"), Body: aws.String(testBody)}, wantEvent: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &rawQueue{FakeSQS: testutil.NewFakeSQS(), messages: []*sqs.Message{tt.msg}}
+			s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{queue})
+
+			events := s.Consume(context.Background())
+			if tt.wantEvent {
+				event := nextEvent(t, events)
+				if event.Retry != 0 {
+					t.Fatalf("event produced with retry %d, want 0 without receive count", event.Retry)
+				}
+				if err := s.Processed(event); err != nil {
+					t.Fatalf("Processed: %v", err)
+				}
+			} else {
+				eventually(t, "the message failed", func() bool { return s.Stats().Failed == tt.wantFailed })
+				noEvent(t, events, quiet)
+			}
+
+			// the consumer keeps consuming the next messages
+			queue.Enqueue(testBody, nil)
+			if err := s.Processed(nextEvent(t, events)); err != nil {
+				t.Fatalf("Processed: %v", err)
+			}
+			if failed := s.Stats().Failed; failed != tt.wantFailed {
+				t.Fatalf("%d messages failed, want %d", failed, tt.wantFailed)
+			}
+			closeSource(t, s)
+		})
+	}
+}
+
+// seenDeduper takes every message as a duplicate.
+type seenDeduper struct{}
+
+func (seenDeduper) Seen(context.Context, string) (bool, error) { return true, nil }
+func (seenDeduper) Forget(context.Context, string) error       { return nil }
+
+func TestCloseAfterErrorPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup enqueues the messages and returns the options of the consumer
+		setup func(fake *testutil.FakeSQS, store *testutil.MemoryStore) []Option
+		// reached reports whether the messages took the path
+		reached func(s *SQSSource, fake *testutil.FakeSQS, events <-chan *domain.Event) bool
+	}{
+		{
+			name: "rate limiter wait",
+			setup: func(fake *testutil.FakeSQS, _ *testutil.MemoryStore) []Option {
+				for i := 0; i < 3; i++ {
+					fake.Enqueue(testBody, nil)
+				}
+				return []Option{WithRateLimit(1, 1)}
+			},
+			reached: func(_ *SQSSource, _ *testutil.FakeSQS, events <-chan *domain.Event) bool { return len(events) == 1 },
+		},
+		{
+			name: "group lock wait",
+			setup: func(fake *testutil.FakeSQS, _ *testutil.MemoryStore) []Option {
+				for i := 0; i < 2; i++ {
+					msg := fake.Enqueue(testBody, nil)
+					msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId] = aws.String("group")
+				}
+				return nil
+			},
+			reached: func(_ *SQSSource, _ *testutil.FakeSQS, events <-chan *domain.Event) bool { return len(events) == 1 },
+		},
+		{
+			name: "filtered out",
+			setup: func(fake *testutil.FakeSQS, _ *testutil.MemoryStore) []Option {
+				fake.Enqueue(testBody, nil)
+				return []Option{WithFilter(func(map[string]*sqs.MessageAttributeValue) bool { return false })}
+			},
+			reached: func(_ *SQSSource, fake *testutil.FakeSQS, _ <-chan *domain.Event) bool {
+				return len(fake.Deleted()) == 1
+			},
+		},
+		{
+			name: "moved to the DLQ",
+			setup: func(fake *testutil.FakeSQS, _ *testutil.MemoryStore) []Option {
+				msg := fake.Enqueue(testBody, nil)
+				msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount] = aws.String("1")
+				return []Option{WithMaxRetries(1), WithDLQ(testutil.NewFakeSQS())}
+			},
+			reached: func(s *SQSSource, _ *testutil.FakeSQS, _ <-chan *domain.Event) bool {
+				return s.Stats().DeadLettered == 1
+			},
+		},
+		{
+			name: "duplicate",
+			setup: func(fake *testutil.FakeSQS, _ *testutil.MemoryStore) []Option {
+				fake.Enqueue(testBody, nil)
+				return []Option{WithDeduper(seenDeduper{})}
+			},
+			reached: func(_ *SQSSource, fake *testutil.FakeSQS, _ <-chan *domain.Event) bool {
+				return len(fake.Deleted()) == 1
+			},
+		},
+		{
+			name: "malformed",
+			setup: func(fake *testutil.FakeSQS, _ *testutil.MemoryStore) []Option {
+				fake.Enqueue(`{"id":`, nil)
+				return nil
+			},
+			reached: func(s *SQSSource, _ *testutil.FakeSQS, _ <-chan *domain.Event) bool { return s.Stats().Failed == 1 },
+		},
+		{
+			name: "persist error",
+			setup: func(fake *testutil.FakeSQS, store *testutil.MemoryStore) []Option {
+				fake.Enqueue(testBody, nil)
+				store.FailInserts(errors.New("connection refused"), 1)
+				return nil
+			},
+			reached: func(s *SQSSource, _ *testutil.FakeSQS, _ <-chan *domain.Event) bool { return s.Stats().Failed == 1 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := testutil.NewFakeSQS()
+			store := testutil.NewMemoryStore()
+			s := newTestSource(t, store, []awssqs.Client{fake}, tt.setup(fake, store)...)
+
+			events := s.Consume(context.Background())
+			eventually(t, "the "+tt.name+" path", func() bool { return tt.reached(s, fake, events) })
+
+			// every message that took the path is done, so Close doesn't wait for it
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := s.Close(ctx); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+			drained(t, events)
+		})
+	}
+}
+
+func TestFlushDeletesBufferedAcks(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	for i := 0; i < 3; i++ {
+		fake.Enqueue(testBody, nil)
+	}
+	// the interval is never reached, so only Flush deletes the partial batch
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithBatchDelete(time.Hour))
+
+	events := s.Consume(context.Background())
+	for i := 0; i < 3; i++ {
+		if err := s.Processed(nextEvent(t, events)); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted before the flush, want the acks buffered", deleted)
+	}
+
+	fake.FailNext(testutil.OpDelete, errors.New("throttled"), 1)
+	if err := s.Flush(context.Background()); err == nil {
+		t.Fatal("Flush returned nil with a failed batch delete")
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// the failed batch is redelivered by SQS, it isn't buffered again
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted by the flush after the failed one", deleted)
+	}
+
+	fake.Redeliver()
+	for i := 0; i < 3; i++ {
+		if err := s.Processed(nextEvent(t, events)); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if deleted := len(fake.Deleted()); deleted != 3 {
+		t.Fatalf("%d messages deleted by the flush, want 3", deleted)
+	}
+	closeSource(t, s)
+}
+
+func TestCloseFlushesBufferedAcks(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithBatchDelete(time.Hour))
+
+	events := s.Consume(context.Background())
+	for i := 0; i < 2; i++ {
+		if err := s.Processed(nextEvent(t, events)); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	closeSource(t, s)
+	if deleted := len(fake.Deleted()); deleted != 2 {
+		t.Fatalf("%d messages deleted by Close, want the 2 acks buffered", deleted)
+	}
+}
@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"service-worker-sqs-postgres/core/domain"
+)
+
+// Codec decodes the bodies of the messages, JSONCodec by default.
+type Codec interface {
+	Decode(data []byte, v interface{}) error
+	Encode(v interface{}) ([]byte, error)
+}
+
+// JSONCodec decodes the bodies as JSON.
+type JSONCodec struct{}
+
+// Decode unmarshals the JSON data into v.
+func (JSONCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Encode marshals v as JSON.
+func (JSONCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// snsNotification is the envelope of the messages delivered by SNS to SQS.
+type snsNotification struct {
+	Type              string                  `json:"Type"`
+	Message           string                  `json:"Message"`
+	MessageAttributes map[string]snsAttribute `json:"MessageAttributes"`
+}
+
+// snsAttribute is a message attribute of an SNS notification.
+type snsAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// decode unmarshals the body of a message with the codec, unwrapping the SNS notification when it's enabled.
+// The SNS envelope is always JSON and its message is decoded with the codec. The body is either a single
+// record or an array of records. The attributes of the SNS notification are returned, if any.
+func (s *SQSSource) decode(body string) ([]domain.Events, map[string]string, error) {
+	var attributes map[string]string
+	if s.snsUnwrap {
+		var notification snsNotification
+		if err := json.Unmarshal([]byte(body), &notification); err == nil && notification.Type == "Notification" {
+			body = notification.Message
+			attributes = make(map[string]string, len(notification.MessageAttributes))
+			for name, attr := range notification.MessageAttributes {
+				attributes[name] = attr.Value
+			}
+		}
+	}
+
+	data := bytes.TrimSpace([]byte(body))
+	// a JSON array is told apart by its first byte, with the other codecs an array is tried first
+	_, isJSON := s.codec.(JSONCodec)
+	if !isJSON || (len(data) > 0 && data[0] == '[') {
+		var records []domain.Events
+		err := s.codec.Decode(data, &records)
+		switch {
+		case err == nil && len(records) == 0:
+			return nil, nil, errors.New("the body is an empty array of records")
+		case err == nil:
+			return records, attributes, nil
+		case isJSON:
+			return nil, nil, err
+		}
+	}
+	var record domain.Events
+	if err := s.codec.Decode(data, &record); err != nil {
+		return nil, nil, err
+	}
+	return []domain.Events{record}, attributes, nil
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestMalformedAction(t *testing.T) {
+	tests := []struct {
+		action        MalformedAction
+		wantDeleted   int
+		wantForwarded int
+	}{
+		{action: MalformedLeave},
+		{action: MalformedDrop, wantDeleted: 1},
+		{action: MalformedDLQ, wantDeleted: 1, wantForwarded: 1},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.action), func(t *testing.T) {
+			fake := testutil.NewFakeSQS()
+			fake.Enqueue(`{"id":`, nil)
+			dlq := testutil.NewFakeSQS()
+			store := testutil.NewMemoryStore()
+			s := newTestSource(t, store, []awssqs.Client{fake}, WithMalformedAction(tt.action), WithDLQ(dlq))
+
+			events := s.Consume(context.Background())
+			eventually(t, "the message failed", func() bool { return s.Stats().Failed == 1 })
+			noEvent(t, events, quiet)
+			if deleted := len(fake.Deleted()); deleted != tt.wantDeleted {
+				t.Fatalf("%d messages deleted, want %d", deleted, tt.wantDeleted)
+			}
+			if forwarded := len(dlq.Forwarded()); forwarded != tt.wantForwarded {
+				t.Fatalf("%d messages moved to the DLQ, want %d", forwarded, tt.wantForwarded)
+			}
+			if dead := s.Stats().DeadLettered; dead != int64(tt.wantForwarded) {
+				t.Fatalf("%d messages dead-lettered, want %d", dead, tt.wantForwarded)
+			}
+			if stored := store.Len(); stored != 0 {
+				t.Fatalf("%d events stored from a malformed message", stored)
+			}
+			closeSource(t, s)
+		})
+	}
+}
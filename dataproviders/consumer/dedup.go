@@ -0,0 +1,49 @@
+package consumer
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Deduper remembers the received messages, so the duplicates are acknowledged before touching the
+// database. redis.Deduper implements it.
+type Deduper interface {
+	// Seen marks id as seen and reports whether it already was.
+	Seen(ctx context.Context, id string) (bool, error)
+	// Forget removes id, so the message isn't taken as a duplicate when it's delivered again.
+	Forget(ctx context.Context, id string) error
+}
+
+// duplicate reports whether the message was already seen by the deduper, such a message is deleted.
+// When the deduper fails the message is processed, the idempotency of the database still applies.
+func (s *SQSSource) duplicate(ctx context.Context, q *queue, msg *sqs.Message) bool {
+	if s.deduper == nil {
+		return false
+	}
+	id := aws.StringValue(msg.MessageId)
+	seen, err := s.deduper.Seen(ctx, id)
+	if err != nil {
+		s.log.Warnf("Error checking if message %s is a duplicate, processing it: %v", id, err)
+		return false
+	}
+	if !seen {
+		return false
+	}
+	s.log.Infof("Message %s was already received, deleting the duplicated message", id)
+	if err := q.client.DeleteMessage(ctx, msg); err != nil {
+		s.log.Errorf("error deleting of sqs message. %v", err)
+	}
+	return true
+}
+
+// forget removes a message that will be delivered again from the deduper.
+func (s *SQSSource) forget(msg *sqs.Message) {
+	if s.deduper == nil {
+		return
+	}
+	id := aws.StringValue(msg.MessageId)
+	if err := s.deduper.Forget(context.Background(), id); err != nil {
+		s.log.Errorf("Error forgetting message %s, its redelivery will be taken as a duplicate: %v", id, err)
+	}
+}
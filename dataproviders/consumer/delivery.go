@@ -0,0 +1,48 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+)
+
+// DeliveryMode is the delivery guarantee of the events produced by the consumer.
+type DeliveryMode string
+
+const (
+	// AtLeastOnce deletes a message once its event is processed. A failed event or a crash of the
+	// consumer redelivers the message, so an event can be handled more than once.
+	AtLeastOnce DeliveryMode = "at-least-once"
+	// AtMostOnce deletes a message before its event is produced, so an event is never handled twice.
+	// An event whose handler fails or that is in-flight when the consumer crashes is LOST: it isn't
+	// retried and only a rejected event is forwarded to the DLQ.
+	AtMostOnce DeliveryMode = "at-most-once"
+)
+
+// deleteBeforeProducing deletes a message in at-most-once mode before its events are produced,
+// when it can't be deleted the events aren't produced.
+func (s *SQSSource) deleteBeforeProducing(ctx context.Context, q *queue, msg *sqs.Message) error {
+	if s.deliveryMode != AtMostOnce {
+		return nil
+	}
+	if err := q.client.DeleteMessage(ctx, msg); err != nil {
+		s.countFailed(q)
+		return fmt.Errorf("error deleting message %s before producing it, the message is left to be redelivered: %w", aws.StringValue(msg.MessageId), err)
+	}
+	return nil
+}
+
+// settleDeleted ends an event whose message was deleted before producing it in at-most-once mode.
+func (s *SQSSource) settleDeleted(event *domain.Event, o outcome, cause error, single bool) error {
+	if o == outcomeRetry {
+		event.Log.Warnf("Event %s failed and won't be retried, its message was deleted in at-most-once mode: %v", event.ID, cause)
+		return nil
+	}
+	if single {
+		s.markProcessed(event.ID)
+	}
+	event.Log.Infof("Step 4 - Event processed, its sqs message was deleted before producing it")
+	return nil
+}
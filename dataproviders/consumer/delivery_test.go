@@ -0,0 +1,63 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestAtMostOnceDeletesBeforeProducing(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithDeliveryMode(AtMostOnce))
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	if deleted := len(fake.Deleted()); deleted != 1 {
+		t.Fatalf("%d messages deleted when the event was produced, want 1", deleted)
+	}
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	if deleted := len(fake.Deleted()); deleted != 1 {
+		t.Fatalf("%d messages deleted after the event was processed, want the single delete before producing it", deleted)
+	}
+	closeSource(t, s)
+}
+
+func TestAtMostOnceFailedEventNotRedelivered(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithDeliveryMode(AtMostOnce))
+
+	events := s.Consume(context.Background())
+	if err := s.Nack(nextEvent(t, events), errors.New("handler failed")); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	noEvent(t, events, quiet)
+	if inFlight := fake.InFlight(); inFlight != 0 {
+		t.Fatalf("%d messages in-flight, the failed event must not be redelivered", inFlight)
+	}
+	if deleted := len(fake.Deleted()); deleted != 1 {
+		t.Fatalf("%d messages deleted, want 1", deleted)
+	}
+	closeSource(t, s)
+}
+
+func TestAtMostOnceDeleteErrorProducesNothing(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	fake.FailNext(testutil.OpDelete, errors.New("throttled"), 1)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithDeliveryMode(AtMostOnce))
+
+	events := s.Consume(context.Background())
+	eventually(t, "the delete failed", func() bool { return s.Stats().Failed == 1 })
+	noEvent(t, events, quiet)
+	if inFlight := fake.InFlight(); inFlight != 1 {
+		t.Fatalf("%d messages in-flight, want the message left to be redelivered", inFlight)
+	}
+	closeSource(t, s)
+}
@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"time"
+)
+
+// QueueDepth returns the approximate number of messages of every queue keyed by queue name,
+// the counts are reported to the metrics too.
+func (s *SQSSource) QueueDepth(ctx context.Context) (map[string]awssqs.QueueAttributes, error) {
+	depth := make(map[string]awssqs.QueueAttributes, len(s.queues))
+	for _, q := range s.queues {
+		attrs, err := q.client.GetQueueAttributes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting attributes of queue %s: %w", q.name, err)
+		}
+		s.metrics.QueueDepth(q.name, attrs.Visible, attrs.NotVisible, attrs.Delayed)
+		depth[q.name] = attrs
+	}
+	return depth, nil
+}
+
+// reportDepthPeriodically reports the depth of the queues to the metrics every depth interval
+// until ctx is done, the first report runs right away.
+func (s *SQSSource) reportDepthPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(s.depthInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.QueueDepth(ctx); err != nil && ctx.Err() == nil {
+			s.log.Warnf("Error reporting the depth of the queues: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+)
+
+// dryRunClient is a queue client that receives the messages but never modifies the queue, the deletes,
+// the visibility changes and the forwards to the DLQ are only logged.
+type dryRunClient struct {
+	awssqs.Client
+	log domain.Logger
+}
+
+// DeleteMessage logs the message instead of deleting it.
+func (c *dryRunClient) DeleteMessage(_ context.Context, msg *sqs.Message) error {
+	c.log.Infof("Dry run, message %s not deleted from %s", aws.StringValue(msg.MessageId), c.URL())
+	return nil
+}
+
+// DeleteMessageBatch logs the messages instead of deleting them.
+func (c *dryRunClient) DeleteMessageBatch(_ context.Context, messages []*sqs.Message) error {
+	c.log.Infof("Dry run, %d messages not deleted from %s", len(messages), c.URL())
+	return nil
+}
+
+// Forward logs the message instead of sending it.
+func (c *dryRunClient) Forward(_ context.Context, msg *sqs.Message, _ map[string]string) error {
+	c.log.Infof("Dry run, message %s not sent to %s", aws.StringValue(msg.MessageId), c.URL())
+	return nil
+}
+
+// Requeue logs the message instead of sending it again.
+func (c *dryRunClient) Requeue(_ context.Context, msg *sqs.Message, _ map[string]string, delaySeconds int) error {
+	c.log.Infof("Dry run, message %s not requeued to %s with a delay of %ds", aws.StringValue(msg.MessageId), c.URL(), delaySeconds)
+	return nil
+}
+
+// ChangeMessageVisibility logs the message instead of changing its visibility.
+func (c *dryRunClient) ChangeMessageVisibility(_ context.Context, msg *sqs.Message, seconds int) error {
+	c.log.Infof("Dry run, visibility of message %s not changed to %ds", aws.StringValue(msg.MessageId), seconds)
+	return nil
+}
+
+// enableDryRun wraps the clients of the queues and the DLQ, so the messages stay in the queues
+// and are delivered again once their visibility timeout expires.
+func (s *SQSSource) enableDryRun() {
+	for _, q := range s.queues {
+		q.client = &dryRunClient{Client: q.client, log: s.log}
+	}
+	if s.dlq != nil {
+		s.dlq = &dryRunClient{Client: s.dlq, log: s.log}
+	}
+	s.log.Warnf("Dry run enabled, the messages are processed but never deleted")
+}
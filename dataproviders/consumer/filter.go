@@ -0,0 +1,29 @@
+package consumer
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// Filter selects the messages to be processed by their message attributes.
+type Filter func(attrs map[string]*sqs.MessageAttributeValue) bool
+
+// accepts reports whether the message passes the filter, every message passes without one.
+func (s *SQSSource) accepts(msg *sqs.Message) bool {
+	return s.filter == nil || s.filter(msg.MessageAttributes)
+}
+
+// skip discards a message rejected by the filter, it's deleted unless the filtered messages are kept
+// for another consumer of the queue.
+func (s *SQSSource) skip(ctx context.Context, q *queue, msg *sqs.Message) {
+	id := aws.StringValue(msg.MessageId)
+	if s.keepFiltered {
+		s.log.Debugf("Message %s filtered out, left in the queue", id)
+		return
+	}
+	s.log.Debugf("Message %s filtered out, deleting it", id)
+	if err := q.client.DeleteMessage(ctx, msg); err != nil {
+		s.log.Errorf("error deleting of sqs message. %v", err)
+	}
+}
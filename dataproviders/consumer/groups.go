@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// groupOf returns the FIFO group of the message, empty for standard queues.
+func groupOf(msg *sqs.Message) string {
+	return aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId])
+}
+
+// splitByGroup splits the messages in jobs, the messages of a FIFO group keep their order in
+// a single job and any other message is a job by itself.
+func splitByGroup(messages []*sqs.Message) [][]*sqs.Message {
+	jobs := make([][]*sqs.Message, 0, len(messages))
+	index := make(map[string]int)
+	for _, msg := range messages {
+		group := groupOf(msg)
+		if group == "" {
+			jobs = append(jobs, []*sqs.Message{msg})
+			continue
+		}
+		i, ok := index[group]
+		if !ok {
+			index[group] = len(jobs)
+			jobs = append(jobs, []*sqs.Message{msg})
+			continue
+		}
+		jobs[i] = append(jobs[i], msg)
+	}
+	return jobs
+}
+
+// lockGroup waits until no other event of the group is in-flight, so a FIFO group is processed in order.
+// It returns false when ctx is done before.
+func (s *SQSSource) lockGroup(ctx context.Context, group string) bool {
+	if group == "" {
+		return true
+	}
+	for {
+		s.groupsMu.Lock()
+		busy, ok := s.groups[group]
+		if !ok {
+			s.groups[group] = make(chan struct{})
+			s.groupsMu.Unlock()
+			return true
+		}
+		s.groupsMu.Unlock()
+
+		select {
+		case <-busy:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// unlockGroup lets the next event of the group to be processed.
+func (s *SQSSource) unlockGroup(group string) {
+	if group == "" {
+		return
+	}
+	s.groupsMu.Lock()
+	defer s.groupsMu.Unlock()
+
+	if busy, ok := s.groups[group]; ok {
+		close(busy)
+		delete(s.groups, group)
+	}
+}
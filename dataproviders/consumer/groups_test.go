@@ -0,0 +1,52 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestFIFOGroupOneAtATimeInOrder(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	for i := 1; i <= 3; i++ {
+		msg := fake.Enqueue(fmt.Sprintf(`{"id":"%d","message":"hello"}`, i), nil)
+		msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId] = aws.String("group")
+	}
+	other := fake.Enqueue(`{"id":"other","message":"hello"}`, nil)
+	other.Attributes[sqs.MessageSystemAttributeNameMessageGroupId] = aws.String("other")
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithWorkers(4))
+
+	events := s.Consume(context.Background())
+	// the other group isn't held by the events in-flight of the group
+	first, second := nextEvent(t, events), nextEvent(t, events)
+	if first.Records.ID == "other" {
+		first, second = second, first
+	}
+	if first.Records.ID != "1" || second.Records.ID != "other" {
+		t.Fatalf("events %s and %s produced first, want 1 and other", first.Records.ID, second.Records.ID)
+	}
+	if err := s.Processed(second); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+
+	event := first
+	for _, want := range []string{"2", "3"} {
+		noEvent(t, events, quiet)
+		if err := s.Processed(event); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+		event = nextEvent(t, events)
+		if event.Records.ID != want {
+			t.Fatalf("event %s produced, want %s", event.Records.ID, want)
+		}
+	}
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	closeSource(t, s)
+}
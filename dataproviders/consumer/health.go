@@ -0,0 +1,107 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultStaleness is the time without a receive after which the consumer isn't live, well over the
+// SQS long polling so a slow receive isn't taken as a stuck consumer.
+const defaultStaleness = 2 * time.Minute
+
+// Health checks the queues and the database are reachable, the error describes every dependency failed.
+func (s *SQSSource) Health(ctx context.Context) error {
+	var failed []string
+	for _, q := range s.queues {
+		if err := q.client.Ping(ctx); err != nil {
+			failed = append(failed, fmt.Sprintf("sqs queue %s: %v", q.name, err))
+		}
+	}
+	if err := s.repo.Ping(ctx); err != nil {
+		failed = append(failed, fmt.Sprintf("database: %v", err))
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Validate checks the queues and the DLQ exist, so a wrong queue URL fails at startup instead of the
+// poll loop retrying the receive forever. The error wraps awssqs.ErrQueueNotFound and names every missing
+// queue by its URL, any other error is only logged since it may be transient and the poll loop retries it.
+func (s *SQSSource) Validate(ctx context.Context) error {
+	clients := make(map[string]awssqs.Client, len(s.queues)+1)
+	for _, q := range s.queues {
+		clients[q.client.URL()] = q.client
+	}
+	if s.dlq != nil {
+		clients[s.dlq.URL()] = s.dlq
+	}
+
+	var missing []string
+	for name, client := range clients {
+		err := client.Ping(ctx)
+		switch {
+		case err == nil:
+		case errors.Is(err, awssqs.ErrQueueNotFound):
+			missing = append(missing, name)
+		default:
+			s.log.Warnf("Couldn't check SQS queue %s exists, the receive will be retried: %v", name, err)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s", awssqs.ErrQueueNotFound, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Liveness checks the consumer is polling, it isn't live when it's closed, every poll loop stopped or
+// there was no receive within the staleness window while it isn't paused.
+func (s *SQSSource) Liveness() error {
+	if s.isClosed() {
+		return errors.New("consumer is closed")
+	}
+	if s.polling.Load() == 0 {
+		return errors.New("consumer isn't polling")
+	}
+	if s.Paused() {
+		return nil
+	}
+	last := s.Stats().LastReceiveAt
+	if last.IsZero() {
+		return nil
+	}
+	if since := time.Since(last); since > s.staleness {
+		return fmt.Errorf("no receive from SQS for %v", since.Round(time.Second))
+	}
+	return nil
+}
+
+// Stalled reports whether the consumer processed nothing within quiet while its queues have visible
+// messages, a stall the Liveness check misses since the poll loops are still running. A consumer that
+// hasn't processed any event yet is measured from its first received message.
+func (s *SQSSource) Stalled(ctx context.Context, quiet time.Duration) (bool, error) {
+	last := s.LastProcessedAt()
+	if last.IsZero() {
+		last = s.LastReceivedAt()
+	}
+	if last.IsZero() || time.Since(last) <= quiet {
+		return false, nil
+	}
+	depth, err := s.QueueDepth(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, attrs := range depth {
+		if attrs.Visible > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
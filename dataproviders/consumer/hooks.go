@@ -0,0 +1,40 @@
+package consumer
+
+import (
+	"service-worker-sqs-postgres/core/domain"
+)
+
+// ReceiveHook is called with every event right before it's produced.
+type ReceiveHook func(e *domain.Event) error
+
+// CompleteHook is called with every event once it's processed or failed, err is set when it failed.
+type CompleteHook func(e *domain.Event, err error) error
+
+// runReceiveHook calls the receive hook, if any. The hooks are best-effort, an error or a panic is only logged.
+func (s *SQSSource) runReceiveHook(event *domain.Event) {
+	if s.onReceive == nil {
+		return
+	}
+	defer s.recoverHook(event, "receive")
+	if err := s.onReceive(event); err != nil {
+		event.Log.Warnf("Error in the receive hook of event %s: %v", event.ID, err)
+	}
+}
+
+// runCompleteHook calls the complete hook, if any.
+func (s *SQSSource) runCompleteHook(event *domain.Event, cause error) {
+	if s.onComplete == nil {
+		return
+	}
+	defer s.recoverHook(event, "complete")
+	if err := s.onComplete(event, cause); err != nil {
+		event.Log.Warnf("Error in the complete hook of event %s: %v", event.ID, err)
+	}
+}
+
+// recoverHook logs the panic of a hook.
+func (s *SQSSource) recoverHook(event *domain.Event, hook string) {
+	if r := recover(); r != nil {
+		event.Log.Errorf("Panic in the %s hook of event %s: %v", hook, event.ID, r)
+	}
+}
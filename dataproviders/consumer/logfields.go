@@ -0,0 +1,28 @@
+package consumer
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+)
+
+// eventTypeAttribute is the message attribute carrying the type of the event, it's logged with the message.
+const eventTypeAttribute = "event-type"
+
+// messageLogger returns the logger of a message, every line carries the fields identifying it: message_id,
+// queue, retry, correlation_id and event_type when the message has one. sns are the attributes of the SNS
+// envelope of the body, if any.
+func (s *SQSSource) messageLogger(q *queue, msg *sqs.Message, sns map[string]string, retry int, correlationID string) domain.Logger {
+	fields := []interface{}{
+		"message_id", aws.StringValue(msg.MessageId),
+		"queue", q.name,
+		"retry", retry,
+	}
+	if correlationID != "" {
+		fields = append(fields, "correlation_id", correlationID)
+	}
+	if eventType := messageAttributes(msg, sns)[eventTypeAttribute]; eventType != "" {
+		fields = append(fields, "event_type", eventType)
+	}
+	return s.log.With(fields...)
+}
@@ -0,0 +1,29 @@
+package consumer
+
+import (
+	"strings"
+	"time"
+)
+
+// Metrics records the consumer activity, metrics.Prometheus implements it.
+type Metrics interface {
+	MessagesReceived(queue string, n int)
+	MessageProcessed(queue string, duration time.Duration)
+	MessageFailed(queue string)
+	ReceiveError(queue string)
+	QueueDepth(queue string, visible, notVisible, delayed int64)
+}
+
+// noMetrics is used when no metrics are configured.
+type noMetrics struct{}
+
+func (noMetrics) MessagesReceived(string, int)           {}
+func (noMetrics) MessageProcessed(string, time.Duration) {}
+func (noMetrics) MessageFailed(string)                   {}
+func (noMetrics) ReceiveError(string)                    {}
+func (noMetrics) QueueDepth(string, int64, int64, int64) {}
+
+// queueName returns the name of the queue from its URL.
+func queueName(url string) string {
+	return url[strings.LastIndex(url, "/")+1:]
+}
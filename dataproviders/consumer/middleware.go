@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"service-worker-sqs-postgres/core/domain"
+	"time"
+)
+
+// Middleware wraps a handler to add a behavior around it.
+type Middleware func(next domain.Handler) domain.Handler
+
+// chain wraps handler with the middlewares, the first middleware is the outermost one so it runs
+// first before the handler and last after it.
+func chain(handler domain.Handler, middlewares ...Middleware) domain.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Recovery turns a panic of the handler into an error, so the event is failed instead of left in-flight.
+func Recovery() Middleware {
+	return func(next domain.Handler) domain.Handler {
+		return func(ctx context.Context, e *domain.Event) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					e.Log.Errorf("Panic handling event %s: %v\n%s", e.ID, r, debug.Stack())
+					err = fmt.Errorf("panic handling event: %v", r)
+				}
+			}()
+			return next(ctx, e)
+		}
+	}
+}
+
+// Latency logs how long the handler took for each event.
+func Latency() Middleware {
+	return func(next domain.Handler) domain.Handler {
+		return func(ctx context.Context, e *domain.Event) error {
+			start := time.Now()
+			err := next(ctx, e)
+			e.Log.Infof("Event %s handled in %dms", e.ID, time.Since(start).Milliseconds())
+			return err
+		}
+	}
+}
+
+// correlationIDKey is the context key of the correlation id.
+type correlationIDKey struct{}
+
+// CorrelationID adds the correlation id of the event to the context of the handler, it's read with
+// CorrelationIDFromContext.
+func CorrelationID() Middleware {
+	return func(next domain.Handler) domain.Handler {
+		return func(ctx context.Context, e *domain.Event) error {
+			return next(context.WithValue(ctx, correlationIDKey{}, e.CorrelationID), e)
+		}
+	}
+}
+
+// CorrelationIDFromContext returns the correlation id added by the CorrelationID middleware, empty if none.
+func CorrelationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,338 @@
+package consumer
+
+import (
+	"go.opentelemetry.io/otel/trace"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"time"
+)
+
+// MalformedAction is what the consumer does with a message whose body can't be decoded.
+type MalformedAction string
+
+const (
+	// MalformedLeave keeps the message in the queue, it's delivered again until it expires or SQS redrives it.
+	MalformedLeave MalformedAction = "leave"
+	// MalformedDrop deletes the message.
+	MalformedDrop MalformedAction = "drop"
+	// MalformedDLQ moves the message to the dead-letter queue, it requires WithDLQ.
+	MalformedDLQ MalformedAction = "dlq"
+)
+
+// Option configures an optional behaviour of the SQSSource.
+type Option func(*SQSSource)
+
+// WithWorkers sets the number of goroutines processing the received messages concurrently,
+// the order of the events inside a batch is best-effort when it's greater than one.
+func WithWorkers(n int) Option {
+	return func(s *SQSSource) {
+		s.workers = n
+	}
+}
+
+// WithSlowThreshold logs a warning for every event taking longer than threshold from when it's produced
+// until it's processed or failed, zero disables it.
+func WithSlowThreshold(threshold time.Duration) Option {
+	return func(s *SQSSource) {
+		s.slowThreshold = threshold
+	}
+}
+
+// WithDeliveryMode sets the delivery guarantee of the events, AtLeastOnce by default. With AtMostOnce
+// the messages are deleted before producing their events, so the failed events are lost.
+func WithDeliveryMode(mode DeliveryMode) Option {
+	return func(s *SQSSource) {
+		s.deliveryMode = mode
+	}
+}
+
+// WithDryRun processes the messages without acknowledging them, nothing is deleted, sent to the DLQ
+// or released, so every message is delivered again once its visibility timeout expires.
+func WithDryRun(enabled bool) Option {
+	return func(s *SQSSource) {
+		s.dryRun = enabled
+	}
+}
+
+// WithLogSampling samples the repetitive logs of the poll loops, like the failed receives and the empty
+// receives: of each kind the first lines of every interval are logged and then one in thereafter. The logs
+// of the messages aren't sampled. By default 10 lines per minute and then one in 100, first 0 disables it.
+func WithLogSampling(interval time.Duration, first, thereafter int) Option {
+	return func(s *SQSSource) {
+		s.sampling = logSampling{interval: interval, first: first, thereafter: thereafter}
+	}
+}
+
+// WithDeduper checks every received message against deduper before storing it, the duplicates
+// are deleted right away.
+func WithDeduper(deduper Deduper) Option {
+	return func(s *SQSSource) {
+		s.deduper = deduper
+	}
+}
+
+// WithCodec sets the codec decoding the bodies of the messages, JSONCodec by default.
+func WithCodec(codec Codec) Option {
+	return func(s *SQSSource) {
+		s.codec = codec
+	}
+}
+
+// WithOnReceive calls hook with every event right before it's produced. The hook is best-effort,
+// its errors are logged.
+func WithOnReceive(hook ReceiveHook) Option {
+	return func(s *SQSSource) {
+		s.onReceive = hook
+	}
+}
+
+// WithOnComplete calls hook with every event once it's processed or failed, with the cause of the
+// failure. The hook is best-effort, its errors are logged.
+func WithOnComplete(hook CompleteHook) Option {
+	return func(s *SQSSource) {
+		s.onComplete = hook
+	}
+}
+
+// WithMaxInFlight stops receiving messages while n events are produced but not processed yet, so the
+// receives follow the ack rate of the downstream. A receive may take up to a batch over n. By default
+// every queue has room for a receive batch.
+func WithMaxInFlight(n int) Option {
+	return func(s *SQSSource) {
+		s.maxInFlight = n
+	}
+}
+
+// WithBufferSize sets the capacity of the event stream, by default it's the max messages of a receive.
+// A larger buffer decouples the downstream from the receives, a smaller one applies backpressure sooner.
+func WithBufferSize(n int) Option {
+	return func(s *SQSSource) {
+		s.bufferSize = n
+	}
+}
+
+// WithBackoff sets the base and max delay waited between failed receives from SQS,
+// the delay doubles on each consecutive failure and resets after a successful receive.
+func WithBackoff(base, max time.Duration) Option {
+	return func(s *SQSSource) {
+		s.backoffBase = base
+		s.backoffMax = max
+	}
+}
+
+// WithEmptyPollDelay sets the delay waited after a receive that returned no messages,
+// zero polls again right away relying only on the SQS long polling. With long polling enabled
+// an empty receive already waited the client WaitTimeSeconds, so both delays add up.
+func WithEmptyPollDelay(d time.Duration) Option {
+	return func(s *SQSSource) {
+		s.emptyDelay = d
+	}
+}
+
+// WithMaxRetries sets the receive count after which a message is moved to the dead-letter queue,
+// zero disables the check.
+func WithMaxRetries(n int) Option {
+	return func(s *SQSSource) {
+		s.maxRetries = n
+	}
+}
+
+// WithDLQ sets the client of the dead-letter queue receiving the messages that exceeded the max retries.
+func WithDLQ(dlq awssqs.Client) Option {
+	return func(s *SQSSource) {
+		s.dlq = dlq
+	}
+}
+
+// WithBatchDelete buffers the acked messages and deletes them in batches of up to 10,
+// a partial batch is flushed after the given interval.
+func WithBatchDelete(interval time.Duration) Option {
+	return func(s *SQSSource) {
+		s.batchDelete = interval
+	}
+}
+
+// WithHeartbeat extends the visibility of in-flight messages to the given extension every interval,
+// so a slow event isn't delivered again while it's still being processed.
+func WithHeartbeat(interval, extension time.Duration) Option {
+	return func(s *SQSSource) {
+		s.heartbeatInterval = interval
+		s.heartbeatExtension = extension
+	}
+}
+
+// WithSNSUnwrap decodes the message bodies as SNS notifications, the event is read from the
+// notification message and the SNS message attributes are kept in the event attributes.
+// A body that isn't an SNS notification is decoded as is.
+func WithSNSUnwrap() Option {
+	return func(s *SQSSource) {
+		s.snsUnwrap = true
+	}
+}
+
+// WithMalformedAction sets what is done with the messages whose body can't be decoded, MalformedLeave by default.
+func WithMalformedAction(action MalformedAction) Option {
+	return func(s *SQSSource) {
+		s.malformed = action
+	}
+}
+
+// WithIdempotency skips the messages of events already processed, they are deleted without being produced
+// again. The check is keyed on the SQS message ID.
+func WithIdempotency() Option {
+	return func(s *SQSSource) {
+		s.idempotent = true
+	}
+}
+
+// WithInFlightWarning logs a warning when the in-flight events reach n, zero disables it.
+func WithInFlightWarning(n int) Option {
+	return func(s *SQSSource) {
+		s.inFlightWarning = n
+	}
+}
+
+// WithMetrics records the consumer activity in m.
+func WithMetrics(m Metrics) Option {
+	return func(s *SQSSource) {
+		s.metrics = m
+	}
+}
+
+// WithTracer starts a span per message with tracer, the trace context of the producer is taken from the
+// message attributes.
+func WithTracer(tracer trace.Tracer) Option {
+	return func(s *SQSSource) {
+		s.tracer = tracer
+	}
+}
+
+// WithRateLimit caps the messages processed to rps per second with bursts of up to burst messages,
+// the wait for the limiter is cancelled when the consumer is closed.
+func WithRateLimit(rps int, burst int) Option {
+	return func(s *SQSSource) {
+		s.rateLimit = rps
+		s.rateBurst = burst
+	}
+}
+
+// WithLeaveOnError keeps the messages whose handler failed in Run invisible until the visibility
+// timeout expires, by default they're nacked to be retried right away.
+func WithLeaveOnError() Option {
+	return func(s *SQSSource) {
+		s.leaveOnError = true
+	}
+}
+
+// WithRetryPolicy lets policy decide in Run whether a failed event is retried and when.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *SQSSource) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithDelayedRetry retries a failed event by sending its message again with the delay of the retry policy,
+// up to awssqs.MaxDelaySeconds, and deleting the received one, instead of changing its visibility. The copy
+// carries the receives of the message in the retry-count attribute, so the retries keep counting, but it
+// has a new message ID and so a new event. Longer
+// delays and FIFO messages, which don't support a delay per message, are still released with the visibility.
+func WithDelayedRetry() Option {
+	return func(s *SQSSource) {
+		s.delayedRetry = true
+	}
+}
+
+// WithAdaptiveBatch adapts the messages requested on each receive, up to the max messages, to the
+// processing latency: the batch grows while the events are processed within target on average and is
+// halved when the latency climbs over it or more than a tenth of the events fail. Zero disables it.
+func WithAdaptiveBatch(target time.Duration) Option {
+	return func(s *SQSSource) {
+		s.batchTarget = target
+	}
+}
+
+// WithAttemptHistory records the outcome of every attempt to process an event, keeping the last keep
+// attempts of each event, they're read with the Attempts method of the repository.
+func WithAttemptHistory(keep int) Option {
+	return func(s *SQSSource) {
+		s.attemptKeep = keep
+	}
+}
+
+// WithProcessTimeout fails the events that aren't processed within timeout, the context of the event
+// is cancelled so the handler can abort. A failed event is nacked, or left with WithLeaveOnError.
+func WithProcessTimeout(timeout time.Duration) Option {
+	return func(s *SQSSource) {
+		s.processTimeout = timeout
+	}
+}
+
+// WithStaleness sets how long Liveness tolerates without a receive from SQS.
+func WithStaleness(staleness time.Duration) Option {
+	return func(s *SQSSource) {
+		s.staleness = staleness
+	}
+}
+
+// WithBatchInsert stores the events of each receive from SQS in a single insert, a failed batch
+// falls back to an insert per event. It can't be used with WithIdempotency.
+func WithBatchInsert() Option {
+	return func(s *SQSSource) {
+		s.batchInsert = true
+	}
+}
+
+// WithRetention purges every hour the processed events older than retention while consuming.
+func WithRetention(retention time.Duration) Option {
+	return func(s *SQSSource) {
+		s.retention = retention
+	}
+}
+
+// WithDepthInterval reports the approximate number of messages of the queues to the metrics every interval
+// while consuming, zero disables it.
+func WithDepthInterval(interval time.Duration) Option {
+	return func(s *SQSSource) {
+		s.depthInterval = interval
+	}
+}
+
+// WithCircuitBreaker opens a circuit breaker after failures consecutive failures of the handler in Run,
+// pausing the intake for cooldown before testing the recovery. Zero failures disables it.
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(s *SQSSource) {
+		s.breakerFailures = failures
+		s.breakerCooldown = cooldown
+	}
+}
+
+// WithClaimCheck downloads from store the payloads offloaded by the producer, the message body is a
+// pointer to them.
+func WithClaimCheck(store awssqs.PayloadStore) Option {
+	return func(s *SQSSource) {
+		s.payloads = store
+	}
+}
+
+// WithFilter only processes the messages whose attributes pass filter, the others are deleted
+// without being emitted.
+func WithFilter(filter Filter) Option {
+	return func(s *SQSSource) {
+		s.filter = filter
+	}
+}
+
+// WithKeepFiltered leaves the messages filtered out in the queue instead of deleting them, so another
+// consumer of the queue can take them once the visibility timeout expires.
+func WithKeepFiltered() Option {
+	return func(s *SQSSource) {
+		s.keepFiltered = true
+	}
+}
+
+// WithMiddleware wraps the handler of Run with middlewares, they run in the given order before the
+// handler and in the reverse order after it. Repeated calls append to the chain.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(s *SQSSource) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
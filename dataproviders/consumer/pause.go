@@ -0,0 +1,94 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Pause stops pulling messages from SQS, the events in-flight are still processed and the
+// event stream is kept open until Resume or Close is called.
+func (s *SQSSource) Pause() {
+	s.pause()
+}
+
+// pause pauses the consumer, it reports false when the consumer was already paused.
+func (s *SQSSource) pause() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if s.resume != nil {
+		return false
+	}
+	s.resume = make(chan struct{})
+	s.log.Infof("Consumer paused")
+	return true
+}
+
+// Resume restarts pulling messages from SQS after a Pause, a drained consumer isn't resumed.
+func (s *SQSSource) Resume() {
+	if s.draining.Load() {
+		s.log.Warnf("Consumer is draining, it can't be resumed")
+		return
+	}
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	if s.resume != nil {
+		close(s.resume)
+		s.resume = nil
+		s.log.Infof("Consumer resumed")
+	}
+}
+
+// Paused reports whether the consumer is paused.
+func (s *SQSSource) Paused() bool {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+	return s.resume != nil
+}
+
+// waitResumed blocks while the consumer is paused, it reports false when ctx is done first.
+func (s *SQSSource) waitResumed(ctx context.Context) bool {
+	s.pauseMu.Lock()
+	resume := s.resume
+	s.pauseMu.Unlock()
+	if resume == nil {
+		return true
+	}
+	select {
+	case <-resume:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Drain stops pulling messages from SQS for good and blocks until the events of the messages already
+// received are processed or ctx is done. The event stream stays open, Close still has to be called to
+// end it. Unlike Pause the consumer can't be resumed, it's meant to stop the intake of an instance
+// before it's terminated.
+func (s *SQSSource) Drain(ctx context.Context) error {
+	s.draining.Store(true)
+	s.Pause()
+	s.log.Infof("Consumer draining, %d events in-flight", s.counters.inFlight.Load())
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.receiving.Load() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("error draining consumer, a receive is still in progress: %w", ctx.Err())
+		}
+	}
+	s.waitInFlight(ctx)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error draining consumer with %d events in-flight: %w", s.counters.inFlight.Load(), err)
+	}
+	s.log.Infof("Consumer drained")
+	return s.Flush(ctx)
+}
+
+// Draining reports whether Drain was called.
+func (s *SQSSource) Draining() bool {
+	return s.draining.Load()
+}
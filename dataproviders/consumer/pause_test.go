@@ -0,0 +1,97 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+// quiet is the window a test waits to check the consumer doesn't receive.
+const quiet = 100 * time.Millisecond
+
+func TestEmptyPollDelay(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithEmptyPollDelay(50*time.Millisecond))
+
+	events := s.Consume(context.Background())
+	time.Sleep(300 * time.Millisecond)
+	closeSource(t, s)
+	drained(t, events)
+
+	// a receive every 50ms, without the delay the loop would poll thousands of times
+	if receives := fake.Receives(); receives < 2 || receives > 8 {
+		t.Fatalf("%d receives in 300ms with an empty poll delay of 50ms", receives)
+	}
+}
+
+func TestNoReceiveWhilePaused(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake})
+	s.Pause()
+
+	events := s.Consume(context.Background())
+	time.Sleep(quiet)
+	if receives := fake.Receives(); receives != 0 {
+		t.Fatalf("%d receives while paused", receives)
+	}
+
+	s.Resume()
+	if err := s.Processed(nextEvent(t, events)); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	closeSource(t, s)
+}
+
+func TestNoReceiveAtCapacity(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithMaxInFlight(1))
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	eventually(t, "the event in-flight", func() bool { return s.Stats().InFlight == 1 })
+	// the receive started before the event was produced may still end
+	time.Sleep(10 * time.Millisecond)
+	receives := fake.Receives()
+	time.Sleep(quiet)
+	if got := fake.Receives(); got != receives {
+		t.Fatalf("%d receives at capacity", got-receives)
+	}
+
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	eventually(t, "a receive once there is capacity", func() bool { return fake.Receives() > receives })
+	closeSource(t, s)
+}
+
+func TestCloseWithDeadlineAtCapacity(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithMaxInFlight(1))
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	eventually(t, "the event in-flight", func() bool { return s.Stats().InFlight == 1 })
+
+	// the poll loop waits for capacity and the event in-flight isn't acked before the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close returned %v, want the deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("Close took %v at capacity", elapsed)
+	}
+	eventually(t, "the poll loop stopped", func() bool { return s.polling.Load() == 0 })
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	drained(t, events)
+}
@@ -0,0 +1,171 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestEventStoredBeforeProduced(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	store := testutil.NewMemoryStore()
+	s := newTestSource(t, store, []awssqs.Client{fake})
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	stored, err := store.GetByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatalf("event %s produced before it was stored: %v", event.ID, err)
+	}
+	if stored.Status != domain.StatusProcessing || stored.Message != "hello" {
+		t.Fatalf("stored event with status %q and message %q", stored.Status, stored.Message)
+	}
+
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	stored, err = store.GetByID(context.Background(), event.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Status != domain.StatusProcessed || stored.ProcessedAt == nil {
+		t.Fatalf("processed event stored with status %q and processed at %v", stored.Status, stored.ProcessedAt)
+	}
+	closeSource(t, s)
+}
+
+func TestIdempotencySkipsProcessedEvents(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	msg := fake.Enqueue(testBody, nil)
+	store := testutil.NewMemoryStore()
+	processed := &domain.Events{ID: aws.StringValue(msg.MessageId), Message: "hello", Status: domain.StatusProcessed}
+	if err := store.Insert(context.Background(), processed); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	s := newTestSource(t, store, []awssqs.Client{fake}, WithIdempotency())
+
+	events := s.Consume(context.Background())
+	eventually(t, "the duplicated message deleted", func() bool { return len(fake.Deleted()) == 1 })
+	noEvent(t, events, quiet)
+	closeSource(t, s)
+}
+
+func TestIdempotencyHandlesRepeatedMessageOnce(t *testing.T) {
+	queue := &rawQueue{FakeSQS: testutil.NewFakeSQS()}
+	msg := queue.Enqueue(testBody, nil)
+	store := testutil.NewMemoryStore()
+	s := newTestSource(t, store, []awssqs.Client{queue}, WithIdempotency())
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	eventually(t, "the message deleted", func() bool { return len(queue.Deleted()) == 1 })
+
+	// SQS delivers the same message again with a new receipt handle
+	queue.mu.Lock()
+	queue.messages = []*sqs.Message{{MessageId: msg.MessageId, ReceiptHandle: aws.String("repeated"), Body: aws.String(testBody)}}
+	queue.mu.Unlock()
+	eventually(t, "the repeated message deleted", func() bool { return len(queue.Deleted()) == 2 })
+	noEvent(t, events, quiet)
+	if stored := store.Len(); stored != 1 {
+		t.Fatalf("%d events stored, want the message stored once", stored)
+	}
+	closeSource(t, s)
+}
+
+func TestPersistErrorLeavesMessage(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	msg := fake.Enqueue(testBody, nil)
+	store := testutil.NewMemoryStore()
+	store.FailInserts(errors.New("connection refused"), 1)
+	s := newTestSource(t, store, []awssqs.Client{fake})
+
+	events := s.Consume(context.Background())
+	eventually(t, "the insert failed", func() bool { return s.Stats().Failed == 1 })
+	noEvent(t, events, quiet)
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted after the insert failed", deleted)
+	}
+	if stored := store.Len(); stored != 0 {
+		t.Fatalf("%d events stored after the insert failed", stored)
+	}
+
+	// once the store is back the redelivered message is processed
+	fake.Redeliver()
+	event := nextEvent(t, events)
+	if event.ID != aws.StringValue(msg.MessageId) {
+		t.Fatalf("produced %s, want the redelivered message %s", event.ID, aws.StringValue(msg.MessageId))
+	}
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	closeSource(t, s)
+}
+
+// memoryDeduper is a Deduper remembering the message IDs in memory.
+type memoryDeduper struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (d *memoryDeduper) Seen(_ context.Context, id string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	seen := d.seen[id]
+	d.seen[id] = true
+	return seen, nil
+}
+
+func (d *memoryDeduper) Forget(_ context.Context, id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, id)
+	return nil
+}
+
+func TestBatchInsertSkipsDuplicate(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	duplicated := fake.Enqueue(testBody, nil)
+	fake.Enqueue(testBody, nil)
+	fake.Enqueue(testBody, nil)
+	id := aws.StringValue(duplicated.MessageId)
+	store := testutil.NewMemoryStore()
+	if err := store.Insert(context.Background(), &domain.Events{ID: id, Message: "first delivery", Status: domain.StatusProcessed}); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	deduper := &memoryDeduper{seen: map[string]bool{id: true}}
+	s := newTestSource(t, store, []awssqs.Client{fake}, WithBatchInsert(), WithDeduper(deduper))
+
+	events := s.Consume(context.Background())
+	for i := 0; i < 2; i++ {
+		event := nextEvent(t, events)
+		if event.ID == id {
+			t.Fatal("the duplicated message was produced")
+		}
+		if err := s.Processed(event); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	noEvent(t, events, quiet)
+	if deleted := len(fake.Deleted()); deleted != 3 {
+		t.Fatalf("%d messages deleted, want the duplicate and the processed ones", deleted)
+	}
+	stored, err := store.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Status != domain.StatusProcessed || stored.Message != "first delivery" {
+		t.Fatalf("duplicated event stored as %+v, want it untouched", stored)
+	}
+	closeSource(t, s)
+}
@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"sync/atomic"
+)
+
+// queue is one of the SQS queues consumed by the source.
+type queue struct {
+	name   string
+	client awssqs.Client
+	// pending are the acked messages waiting to be deleted in batch, guarded by pendingMu.
+	pending []*sqs.Message
+	// interval is the wait between receives while SQS throttles the queue, in nanoseconds.
+	interval atomic.Int64
+	// counters are the counters of the messages of the queue, reported in the Queues of Stats.
+	counters queueCounters
+}
+
+// job is a group of messages of a queue handed to a worker.
+type job struct {
+	queue    *queue
+	messages []*sqs.Message
+	// prepared are the messages prepared by persistBatch keyed by message ID, if any.
+	prepared map[string]*batched
+}
+
+// queueOf returns the queue the event was received from.
+func (s *SQSSource) queueOf(event *domain.Event) (*queue, bool) {
+	q, ok := s.queuesByURL[event.Queue]
+	return q, ok
+}
+
+// groupKey returns the key locking the FIFO group of the message, the groups are scoped by queue.
+func groupKey(q *queue, msg *sqs.Message) string {
+	group := groupOf(msg)
+	if group == "" {
+		return ""
+	}
+	return q.name + "/" + group
+}
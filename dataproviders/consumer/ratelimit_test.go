@@ -0,0 +1,57 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestRateLimitThroughput(t *testing.T) {
+	const (
+		rps      = 50
+		messages = 11
+	)
+	fake := testutil.NewFakeSQS()
+	for i := 0; i < messages; i++ {
+		fake.Enqueue(testBody, nil)
+	}
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithRateLimit(rps, 1), WithWorkers(4))
+
+	start := time.Now()
+	events := s.Consume(context.Background())
+	for i := 0; i < messages; i++ {
+		if err := s.Processed(nextEvent(t, events)); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	// the burst lets the first message through, each of the others waits 1/rps
+	if elapsed, min := time.Since(start), (messages-1)*time.Second/rps; elapsed < min*9/10 {
+		t.Fatalf("%d messages processed in %v, want at least %v at %d per second", messages, elapsed, min, rps)
+	}
+	closeSource(t, s)
+}
+
+func TestRateLimitWaitCancelledOnClose(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	for i := 0; i < 3; i++ {
+		fake.Enqueue(testBody, nil)
+	}
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithRateLimit(1, 1))
+
+	events := s.Consume(context.Background())
+	if err := s.Processed(nextEvent(t, events)); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	start := time.Now()
+	closeSource(t, s)
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Fatalf("Close took %v waiting for the rate limiter", elapsed)
+	}
+	drained(t, events)
+	if deleted := len(fake.Deleted()); deleted != 1 {
+		t.Fatalf("%d messages deleted, want only the one processed", deleted)
+	}
+}
@@ -0,0 +1,161 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+	"sync"
+	"time"
+)
+
+// outcome is how an in-flight event ended, the greater outcome wins when the records of a message are combined.
+type outcome int
+
+const (
+	outcomeProcessed outcome = iota
+	outcomeRetry
+	outcomeReject
+)
+
+// delivery tracks the events produced from the records of one message, the message is
+// settled once all of them are.
+type delivery struct {
+	mu         sync.Mutex
+	remaining  int
+	outcome    outcome
+	visibility int
+	cause      error
+}
+
+// settle records the outcome of one of the events, it reports whether it was the last one
+// along with the combined outcome of the message. The retried records keep the shortest visibility.
+func (d *delivery) settle(o outcome, visibility int, cause error) (bool, outcome, int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case o > d.outcome:
+		d.outcome, d.visibility, d.cause = o, visibility, cause
+	case o == outcomeRetry && d.outcome == outcomeRetry:
+		if d.visibility == leaveVisibility || (visibility != leaveVisibility && visibility < d.visibility) {
+			d.visibility = visibility
+		}
+	}
+	d.remaining--
+	return d.remaining == 0, d.outcome, d.visibility, d.cause
+}
+
+// recordID returns the ID of the i-th record of a message.
+func recordID(msgID string, i int) string {
+	return fmt.Sprintf("%s-%d", msgID, i)
+}
+
+// processRecords produces one event per record of a message whose body is an array of records. The events
+// are tracked by a delivery of the message, so it's only deleted once every event is processed.
+func (s *SQSSource) processRecords(ctx context.Context, q *queue, msg *sqs.Message, records []domain.Events, attributes map[string]string, retry int, spanCtx context.Context, out chan *domain.Event, produced *bool) error {
+	msgID := aws.StringValue(msg.MessageId)
+	correlationID := s.correlationID(msg, attributes)
+	logger := s.messageLogger(q, msg, attributes, retry, correlationID)
+	logger.Infof("Step 1 - Start to process SQS event with %d records", len(records))
+
+	events := make([]*domain.Event, 0, len(records))
+	for i, record := range records {
+		eventDB := s.newRecord(recordID(msgID, i), record, retry, correlationID)
+		processed, err := s.persist(ctx, eventDB)
+		if err != nil {
+			s.countFailed(q)
+			return fmt.Errorf("error inserting event %s, the message is left to be redelivered: %w", eventDB.ID, err)
+		}
+		if processed {
+			logger.Infof("Event %s was already processed, skipping the record", eventDB.ID)
+			continue
+		}
+		events = append(events, &domain.Event{
+			ID:            eventDB.ID,
+			Retry:         retry,
+			Queue:         q.client.URL(),
+			CorrelationID: correlationID,
+			Records:       record,
+			Attributes:    messageAttributes(msg, attributes),
+			OriginalEvent: msg,
+			Log:           logger,
+			StartedAt:     time.Now(),
+			Context:       spanCtx,
+
+			SentTimestamp:  sentTimestamp(msg),
+			MessageGroupID: groupOf(msg),
+		})
+	}
+	if len(events) == 0 {
+		logger.Infof("Every record of message %s was already processed, deleting the duplicated message", msgID)
+		if err := q.client.DeleteMessage(ctx, msg); err != nil {
+			logger.Errorf("error deleting of sqs message. %v", err)
+		}
+		return nil
+	}
+	logger.Infof("Step 2 - Events saved in postgres")
+	if err := s.deleteBeforeProducing(ctx, q, msg); err != nil {
+		return err
+	}
+
+	s.deliveriesMu.Lock()
+	s.deliveries[msgID] = &delivery{remaining: len(events)}
+	s.deliveriesMu.Unlock()
+	s.wg.Add(len(events) - 1)
+	s.startHeartbeat(ctx, q, logger, msg)
+	for i, event := range events {
+		s.trackDeadline(event)
+		s.updateStatus(event.ID, domain.StatusProcessing, nil)
+		s.runReceiveHook(event)
+		select {
+		case out <- event:
+			*produced = true
+			s.armDeadline(event)
+			s.counters.emitted.Add(1)
+			if inFlight := s.counters.inFlight.Add(1); s.inFlightWarning > 0 && inFlight >= int64(s.inFlightWarning) {
+				logger.Warnf("%d events in-flight waiting to be processed, the downstream may be stalled", inFlight)
+			}
+			logger.Infof("Step 3 - Event produced for ID = %s)", event.ID)
+		case <-ctx.Done():
+			logger.Warnf("%d events of message %s not produced, the consumer is shutting down", len(events)-i, msgID)
+			s.abandon(msg, events[i:], *produced)
+			return nil
+		}
+	}
+	return nil
+}
+
+// abandon releases the events of a message that weren't produced. When none was produced the
+// delivery is dropped and the message is released by processMessage, otherwise they're settled
+// so the message is left in the queue once the produced ones end.
+func (s *SQSSource) abandon(msg *sqs.Message, events []*domain.Event, produced bool) {
+	for _, event := range events {
+		s.claim(event)
+	}
+	if !produced {
+		s.forgetDelivery(msg)
+		s.stopHeartbeat(aws.StringValue(msg.MessageId))
+		s.wg.Add(1 - len(events))
+		return
+	}
+	for _, event := range events {
+		s.wg.Done()
+		_ = s.settle(event, outcomeRetry, leaveVisibility, nil)
+	}
+}
+
+// deliveryOf returns the delivery of a message with several records, if any.
+func (s *SQSSource) deliveryOf(msg *sqs.Message) (*delivery, bool) {
+	s.deliveriesMu.Lock()
+	defer s.deliveriesMu.Unlock()
+	d, ok := s.deliveries[aws.StringValue(msg.MessageId)]
+	return d, ok
+}
+
+// forgetDelivery drops the delivery of a message once it's settled.
+func (s *SQSSource) forgetDelivery(msg *sqs.Message) {
+	s.deliveriesMu.Lock()
+	delete(s.deliveries, aws.StringValue(msg.MessageId))
+	s.deliveriesMu.Unlock()
+}
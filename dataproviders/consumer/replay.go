@@ -0,0 +1,68 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"service-worker-sqs-postgres/core/domain"
+	"time"
+)
+
+// replayPageSize is the number of stored events read by each query of Replay.
+const replayPageSize = 100
+
+// Replay calls handler again with the stored events matching filter, the oldest first, without
+// receiving them from SQS. The events are handled one by one as in Run, with the middlewares and
+// the retry policy, but their OriginalEvent is nil so there is no message to delete or release:
+// only their status is updated. The matching events are read before replaying them, so the events
+// whose status changes while replaying aren't replayed twice. It returns the number of events replayed.
+func (s *SQSSource) Replay(ctx context.Context, filter domain.EventFilter, handler domain.Handler) (int, error) {
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return 0, fmt.Errorf("invalid replay range: to %v is before from %v", filter.To, filter.From)
+	}
+	var records []*domain.Events
+	for offset := 0; ; offset += replayPageSize {
+		page, err := s.repo.List(ctx, filter, replayPageSize, offset)
+		if err != nil {
+			return 0, fmt.Errorf("error listing the events to replay: %w", err)
+		}
+		records = append(records, page...)
+		if len(page) < replayPageSize {
+			break
+		}
+	}
+	s.log.Infof("Replaying %d stored events", len(records))
+
+	handler = chain(handler, s.middlewares...)
+	replayed := 0
+	// the listing is the most recent first
+	for i := len(records) - 1; i >= 0; i-- {
+		if ctx.Err() != nil || s.isClosed() {
+			return replayed, fmt.Errorf("replay stopped after %d of %d events", replayed, len(records))
+		}
+		s.handle(ctx, handler, s.replayEvent(ctx, records[i]))
+		replayed++
+	}
+	return replayed, nil
+}
+
+// replayEvent tracks a stored event as in-flight and returns it to be handled again.
+func (s *SQSSource) replayEvent(ctx context.Context, record *domain.Events) *domain.Event {
+	retry := record.Retry
+	event := &domain.Event{
+		ID:            record.ID,
+		Retry:         retry,
+		CorrelationID: record.CorrelationID,
+		Records:       *record,
+		Log:           s.log.With("message_id", record.ID, "retry", retry, "correlation_id", record.CorrelationID, "replay", true),
+		StartedAt:     time.Now(),
+		Context:       ctx,
+	}
+	s.wg.Add(1)
+	s.counters.inFlight.Add(1)
+	s.trackDeadline(event)
+	s.armDeadline(event)
+	s.updateStatus(event.ID, domain.StatusProcessing, nil)
+	event.Log.Infof("Replaying event %s", event.ID)
+	s.runReceiveHook(event)
+	return event
+}
@@ -0,0 +1,41 @@
+package consumer
+
+import (
+	"context"
+	"service-worker-sqs-postgres/core/domain"
+	"time"
+)
+
+// retentionInterval is how often the processed events over the retention are purged.
+const retentionInterval = time.Hour
+
+// purgePeriodically removes the processed events older than the retention every retention interval
+// until ctx is done, the first purge runs right away.
+func (s *SQSSource) purgePeriodically(ctx context.Context) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		s.purge(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// purge removes the processed events older than the retention, a failure is only logged since
+// it's retried on the next interval.
+func (s *SQSSource) purge(ctx context.Context) {
+	cutoff := time.Now().UTC().Add(-s.retention)
+	deleted, err := s.repo.DeleteOlderThan(ctx, domain.StatusProcessed, cutoff)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.log.Errorf("Error purging processed events before %v: %v", cutoff, err)
+		}
+		return
+	}
+	if deleted > 0 {
+		s.log.Infof("Purged %d processed events before %v", deleted, cutoff)
+	}
+}
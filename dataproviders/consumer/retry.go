@@ -0,0 +1,118 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides what to do with an event whose handler failed in Run. A retried event is visible
+// again after delay, otherwise it's moved to the DLQ.
+type RetryPolicy interface {
+	ShouldRetry(event *domain.Event, err error) (retry bool, delay time.Duration)
+}
+
+// ExponentialRetry retries an event up to MaxRetries times, doubling the delay from Base up to Max
+// on every receive of the message.
+type ExponentialRetry struct {
+	MaxRetries int
+	Base       time.Duration
+	Max        time.Duration
+}
+
+// NewExponentialRetry creates the default retry policy.
+func NewExponentialRetry(maxRetries int, base, max time.Duration) *ExponentialRetry {
+	return &ExponentialRetry{MaxRetries: maxRetries, Base: base, Max: max}
+}
+
+// ShouldRetry retries while the receive count of the event is under the max retries.
+func (p *ExponentialRetry) ShouldRetry(event *domain.Event, _ error) (bool, time.Duration) {
+	count := event.Retry
+	if count >= p.MaxRetries {
+		return false, 0
+	}
+	delay := p.Base
+	for i := 1; i < count && delay < p.Max; i++ {
+		delay *= 2
+	}
+	if delay > p.Max {
+		delay = p.Max
+	}
+	return true, delay
+}
+
+// retryOrReject applies the retry policy to an event whose handler failed because of cause.
+func (s *SQSSource) retryOrReject(event *domain.Event, cause error) error {
+	retry, delay := s.retryPolicy.ShouldRetry(event, cause)
+	if retry {
+		if delay > maxVisibility {
+			delay = maxVisibility
+		}
+		return s.fail(event, cause, int(delay.Seconds()))
+	}
+	return s.reject(event, cause)
+}
+
+// reject moves an event that won't be retried to the DLQ, when there is no one configured the message is only deleted.
+func (s *SQSSource) reject(event *domain.Event, cause error) error {
+	if !s.claim(event) {
+		return fmt.Errorf("error rejecting event %s: %w", event.ID, s.errUnclaimed())
+	}
+	defer s.wg.Done()
+	defer s.completed(event, cause)
+	defer endSpan(event.Context, cause)
+	s.updateStatus(event.ID, domain.StatusFailed, cause)
+	return s.settle(event, outcomeReject, 0, cause)
+}
+
+// retriesAttribute is the message attribute carrying the receives of the messages requeued with a delay,
+// they're added to the receive count of the copy.
+const retriesAttribute = "retry-count"
+
+// requeueMessage sends a failed message again delayed visibility seconds and deletes it, so it isn't
+// received meanwhile by the consumers. It's released as in releaseMessage when the delay can't be set on
+// the message: without delay, over awssqs.MaxDelaySeconds or on a FIFO queue, or when the copy can't be sent.
+func (s *SQSSource) requeueMessage(q *queue, msg *sqs.Message, logger domain.Logger, retry, visibility int) error {
+	if visibility <= 0 || visibility > awssqs.MaxDelaySeconds || groupOf(msg) != "" {
+		return s.releaseMessage(q, msg, logger, visibility)
+	}
+	if err := q.client.Requeue(context.Background(), msg, map[string]string{retriesAttribute: strconv.Itoa(retry)}, visibility); err != nil {
+		logger.Errorf("Error requeuing sqs message %s, releasing it: %v", aws.StringValue(msg.MessageId), err)
+		return s.releaseMessage(q, msg, logger, visibility)
+	}
+	if err := q.client.DeleteMessage(context.Background(), msg); err != nil {
+		logger.Errorf("error deleting of requeued sqs message, it will be delivered twice. %v", err)
+		return err
+	}
+	logger.Infof("Step 4 - Requeued sqs message to be retried in %ds", visibility)
+	return nil
+}
+
+// rejectMessage forwards a message that won't be retried to the DLQ, if any, and deletes it.
+func (s *SQSSource) rejectMessage(q *queue, msg *sqs.Message, logger domain.Logger, retry int, cause error) error {
+	id := aws.StringValue(msg.MessageId)
+	if s.dlq != nil {
+		if err := s.dlq.Forward(context.Background(), msg, map[string]string{"ReceiveCount": strconv.Itoa(retry), "Error": cause.Error()}); err != nil {
+			logger.Errorf("Error sending message %s to the DLQ: %v", id, err)
+			return err
+		}
+		s.countDeadLettered(q)
+		logger.Warnf("Message %s won't be retried, moved to the DLQ: %v", id, cause)
+	} else {
+		logger.Warnf("Message %s won't be retried and no DLQ is configured, discarding it: %v", id, cause)
+	}
+	if s.deliveryMode == AtMostOnce {
+		// the message was deleted before producing its events
+		return nil
+	}
+	if err := q.client.DeleteMessage(context.Background(), msg); err != nil {
+		logger.Errorf("error deleting of sqs message. %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestExceededRetriesMovesToDLQ(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	msg := fake.Enqueue(testBody, nil)
+	// the receive makes it the third
+	msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount] = aws.String("2")
+	dlq := testutil.NewFakeSQS()
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithMaxRetries(2), WithDLQ(dlq))
+
+	events := s.Consume(context.Background())
+	eventually(t, "the message moved to the DLQ", func() bool { return len(dlq.Forwarded()) == 1 })
+	noEvent(t, events, quiet)
+	if deleted := fake.Deleted(); len(deleted) != 1 || deleted[0] != msg {
+		t.Fatalf("deleted %v, want the message moved to the DLQ", deleted)
+	}
+	if dead := s.Stats().DeadLettered; dead != 1 {
+		t.Fatalf("%d messages dead-lettered, want 1", dead)
+	}
+	closeSource(t, s)
+}
+
+func TestNackRedelivers(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake})
+
+	events := s.Consume(context.Background())
+	first := nextEvent(t, events)
+	if err := s.Nack(first, errors.New("downstream failed")); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	second := nextEvent(t, events)
+	if second.ID != first.ID || second.Retry != first.Retry+1 {
+		t.Fatalf("redelivered %s with retry %d, want %s with retry %d", second.ID, second.Retry, first.ID, first.Retry+1)
+	}
+	if err := s.Processed(second); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	eventually(t, "the message deleted", func() bool { return len(fake.Deleted()) == 1 })
+	closeSource(t, s)
+}
+
+func TestReceiveErrorsBackOff(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	fake.FailNext(testutil.OpReceive, errors.New("connection reset"), 3)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithBackoff(10*time.Millisecond, 40*time.Millisecond))
+
+	start := time.Now()
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	// the delays of 10ms, 20ms and 40ms are jittered down to half at most
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Fatalf("event produced after %v, the receive errors weren't backed off", elapsed)
+	}
+	if receives := fake.Receives(); receives < 4 {
+		t.Fatalf("%d receives, want the 3 failed and the successful one at least", receives)
+	}
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	closeSource(t, s)
+}
@@ -0,0 +1,92 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"service-worker-sqs-postgres/core/domain"
+)
+
+// ErrDeadLetter is returned by a handler in Run to move the event to the DLQ right away, without
+// retrying it. When there is no DLQ the message is discarded.
+var ErrDeadLetter = errors.New("event sent to the dead-letter queue")
+
+// UnknownAction is what a Router does with an event of a type without handler.
+type UnknownAction string
+
+const (
+	// UnknownError fails the event, so it's retried as any failed event.
+	UnknownError UnknownAction = "error"
+	// UnknownDrop acks the event without handling it.
+	UnknownDrop UnknownAction = "drop"
+	// UnknownDLQ moves the event to the DLQ with ErrDeadLetter.
+	UnknownDLQ UnknownAction = "dlq"
+)
+
+// TypeFunc returns the type of an event that selects its handler in a Router.
+type TypeFunc func(e *domain.Event) string
+
+// AttributeType reads the type of an event from the message attribute name, the attributes of
+// the SNS notification are looked up too.
+func AttributeType(name string) TypeFunc {
+	return func(e *domain.Event) string {
+		return e.Attributes[name]
+	}
+}
+
+// Router dispatches each event to the handler registered for its type, it's used as the handler of Run
+// with router.Handle. The events of a type without handler go to the fallback when there is one,
+// otherwise the unknown action applies.
+type Router struct {
+	typeOf   TypeFunc
+	handlers map[string]domain.Handler
+	fallback domain.Handler
+	unknown  UnknownAction
+}
+
+// NewRouter creates a Router reading the type of the events with typeOf, the unknown types fail by default.
+func NewRouter(typeOf TypeFunc) *Router {
+	return &Router{
+		typeOf:   typeOf,
+		handlers: make(map[string]domain.Handler),
+		unknown:  UnknownError,
+	}
+}
+
+// On registers handler for the events of type eventType, it replaces any previous one.
+func (r *Router) On(eventType string, handler domain.Handler) *Router {
+	r.handlers[eventType] = handler
+	return r
+}
+
+// Fallback sets the handler of the events whose type has no handler.
+func (r *Router) Fallback(handler domain.Handler) *Router {
+	r.fallback = handler
+	return r
+}
+
+// Unknown sets what to do with the events whose type has no handler when there is no fallback.
+func (r *Router) Unknown(action UnknownAction) *Router {
+	r.unknown = action
+	return r
+}
+
+// Handle calls the handler of the type of the event.
+func (r *Router) Handle(ctx context.Context, e *domain.Event) error {
+	eventType := r.typeOf(e)
+	if handler, ok := r.handlers[eventType]; ok {
+		return handler(ctx, e)
+	}
+	if r.fallback != nil {
+		return r.fallback(ctx, e)
+	}
+	switch r.unknown {
+	case UnknownDrop:
+		e.Log.Warnf("Event %s of unknown type %q dropped", e.ID, eventType)
+		return nil
+	case UnknownDLQ:
+		return fmt.Errorf("unknown event type %q: %w", eventType, ErrDeadLetter)
+	default:
+		return fmt.Errorf("no handler for event type %q", eventType)
+	}
+}
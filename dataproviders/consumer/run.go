@@ -0,0 +1,107 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"service-worker-sqs-postgres/core/domain"
+	"sync"
+)
+
+// Run consumes the events and calls handler for each one until ctx is cancelled or the source is closed.
+// An event is acked when handler returns nil, otherwise the retry policy decides whether it's retried
+// or moved to the DLQ. Without a policy it's nacked, or left to be retried after the visibility timeout
+// with WithLeaveOnError. A handler returning ErrDeadLetter moves the event to the DLQ right away. The
+// handler is wrapped with the middlewares of WithMiddleware, and Run returns once every handler returned.
+// With WithCircuitBreaker the events arriving while the breaker is open are left to be retried after the
+// visibility timeout. The handler gets the context of the event, with its trace span and process timeout,
+// also cancelled with ctx.
+func (s *SQSSource) Run(ctx context.Context, handler domain.Handler) error {
+	handler = chain(handler, s.middlewares...)
+	var handlers sync.WaitGroup
+	for event := range s.Consume(ctx) {
+		handlers.Add(1)
+		go func(event *domain.Event) {
+			defer handlers.Done()
+			s.handle(ctx, handler, event)
+		}(event)
+	}
+	handlers.Wait()
+	if s.isClosed() {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// handle calls handler with the event and acks it according to the result, a panic is a failure.
+func (s *SQSSource) handle(ctx context.Context, handler domain.Handler, event *domain.Event) {
+	ctx, cancel := eventContext(ctx, event)
+	defer cancel()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				event.Log.Errorf("Panic handling event %s: %v\n%s", event.ID, r, debug.Stack())
+				err = fmt.Errorf("panic handling event: %v", r)
+			}
+		}()
+		if s.breaker == nil {
+			return handler(ctx, event)
+		}
+		_, err = s.breaker.Execute(func() (interface{}, error) {
+			return nil, handler(ctx, event)
+		})
+		return err
+	}()
+	if err == nil {
+		if err = s.Processed(event); err != nil {
+			event.Log.Errorf("Error processing event: %v", err)
+		}
+		return
+	}
+
+	if rejectedByBreaker(err) {
+		event.Log.Warnf("Event %s not handled, the circuit breaker is %s", event.ID, s.breaker.State())
+		if err = s.fail(event, err, leaveVisibility); err != nil {
+			event.Log.Errorf("Error releasing event: %v", err)
+		}
+		return
+	}
+	event.Log.Errorf("Error handling event %s: %v", event.ID, err)
+	if errors.Is(err, ErrDeadLetter) {
+		if err = s.reject(event, err); err != nil {
+			event.Log.Errorf("Error releasing event: %v", err)
+		}
+		return
+	}
+	if s.retryPolicy != nil {
+		if err = s.retryOrReject(event, err); err != nil {
+			event.Log.Errorf("Error releasing event: %v", err)
+		}
+		return
+	}
+	visibility := 0
+	if s.leaveOnError {
+		visibility = leaveVisibility
+	}
+	if err = s.fail(event, err, visibility); err != nil {
+		event.Log.Errorf("Error releasing event: %v", err)
+	}
+}
+
+// eventContext returns the context of the event, with its trace span and process timeout, cancelled
+// with ctx too. Without a context of the event it's ctx.
+func eventContext(ctx context.Context, event *domain.Event) (context.Context, context.CancelFunc) {
+	if event.Context == nil {
+		return ctx, func() {}
+	}
+	eventCtx, cancel := context.WithCancel(event.Context)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-eventCtx.Done():
+		}
+	}()
+	return eventCtx, cancel
+}
@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"go.opentelemetry.io/otel/trace"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+// run runs s with handler until the test closes it, the returned channel gets the error of Run.
+func run(t *testing.T, s *SQSSource, handler domain.Handler) <-chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(context.Background(), handler)
+	}()
+	return done
+}
+
+// stop closes s and checks Run returned nil.
+func stop(t *testing.T, s *SQSSource, done <-chan error) {
+	t.Helper()
+	closeSource(t, s)
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+}
+
+func TestRunRecoversHandlerPanic(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	panicking := fake.Enqueue(`{"id":"1","message":"panic"}`, nil)
+	fake.Enqueue(testBody, nil)
+	// the failed message is left in-flight instead of being redelivered right away
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithLeaveOnError())
+
+	done := run(t, s, func(_ context.Context, e *domain.Event) error {
+		if e.Records.Message == "panic" {
+			panic("handler failed")
+		}
+		return nil
+	})
+	eventually(t, "the events handled", func() bool {
+		stats := s.Stats()
+		return stats.Acked == 1 && stats.Failed == 1
+	})
+	for _, msg := range fake.Deleted() {
+		if aws.StringValue(msg.MessageId) == aws.StringValue(panicking.MessageId) {
+			t.Fatal("the message whose handler panicked was deleted")
+		}
+	}
+
+	// the consumer keeps handling new messages
+	fake.Enqueue(testBody, nil)
+	eventually(t, "the next event handled", func() bool { return s.Stats().Acked == 2 })
+	if inFlight := fake.InFlight(); inFlight != 1 {
+		t.Fatalf("%d messages in-flight, want the one whose handler panicked", inFlight)
+	}
+	stop(t, s, done)
+}
+
+// panicCodec is a JSON codec that panics decoding the body "boom".
+type panicCodec struct{}
+
+func (panicCodec) Decode(data []byte, v interface{}) error {
+	if string(data) == "boom" {
+		panic("decoder failed")
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (panicCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func TestProcessMessageRecoversPanic(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue("boom", nil)
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithCodec(panicCodec{}), WithWorkers(1))
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	if event.Records.Message != "hello" {
+		t.Fatalf("event with message %q produced", event.Records.Message)
+	}
+	if err := s.Processed(event); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	noEvent(t, events, quiet)
+	if deleted := len(fake.Deleted()); deleted != 1 {
+		t.Fatalf("%d messages deleted, want only the one processed", deleted)
+	}
+	if inFlight := fake.InFlight(); inFlight != 1 {
+		t.Fatalf("%d messages in-flight, want the one whose decoding panicked", inFlight)
+	}
+	closeSource(t, s)
+}
+
+func TestRunWithSignalsFinishesRunningHandler(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	// the process timeout gives the handler the context of the event
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithProcessTimeout(testTimeout))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.RunWithSignals(context.Background(), func(ctx context.Context, _ *domain.Event) error {
+			close(started)
+			select {
+			case <-release:
+			case <-ctx.Done():
+			}
+			handlerErr <- ctx.Err()
+			return ctx.Err()
+		}, testTimeout)
+	}()
+	select {
+	case <-started:
+	case <-time.After(testTimeout):
+		t.Fatal("the handler wasn't called")
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	eventually(t, "the source closed", s.isClosed)
+	// the handler isn't cancelled by the signal
+	time.Sleep(quiet)
+	close(release)
+	if err := <-handlerErr; err != nil {
+		t.Fatalf("handler context: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("RunWithSignals: %v", err)
+	}
+	if deleted := len(fake.Deleted()); deleted != 1 {
+		t.Fatalf("%d messages deleted, want the one being handled on the signal", deleted)
+	}
+}
+
+func TestRunPassesEventContext(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake})
+
+	traceIDs := make(chan string, 1)
+	done := run(t, s, func(ctx context.Context, _ *domain.Event) error {
+		traceIDs <- trace.SpanFromContext(ctx).SpanContext().TraceID().String()
+		return nil
+	})
+	select {
+	case traceID := <-traceIDs:
+		if traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("handler got trace %s, want the trace of the message", traceID)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("the handler wasn't called")
+	}
+	stop(t, s, done)
+}
@@ -0,0 +1,114 @@
+package consumer
+
+import (
+	"fmt"
+	"service-worker-sqs-postgres/core/domain"
+	"sync"
+	"time"
+)
+
+// Default sampling of the repetitive logs of the poll loops.
+const (
+	defaultSamplingInterval   = time.Minute
+	defaultSamplingFirst      = 10
+	defaultSamplingThereafter = 100
+)
+
+// logSampling logs the first lines of each template in every interval and then one in thereafter.
+type logSampling struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+}
+
+// sampledLogger is a domain.Logger applying a logSampling to each template, the loggers returned by
+// With share the counts of their parent.
+type sampledLogger struct {
+	domain.Logger
+	sampling logSampling
+	mu       *sync.Mutex
+	counts   map[string]*sampleCount
+}
+
+// sampleCount counts the lines of a template within the current interval.
+type sampleCount struct {
+	start   time.Time
+	n       int
+	dropped int
+}
+
+// newSampledLogger returns log sampled with sampling.
+func newSampledLogger(log domain.Logger, sampling logSampling) *sampledLogger {
+	return &sampledLogger{
+		Logger:   log,
+		sampling: sampling,
+		mu:       &sync.Mutex{},
+		counts:   make(map[string]*sampleCount),
+	}
+}
+
+// sample reports whether a line of template is logged, along with the lines dropped since the last one.
+func (l *sampledLogger) sample(template string) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	c, ok := l.counts[template]
+	if !ok || now.Sub(c.start) >= l.sampling.interval {
+		dropped := 0
+		if ok {
+			dropped = c.dropped
+		}
+		l.counts[template] = &sampleCount{start: now, n: 1}
+		return true, dropped
+	}
+	c.n++
+	if c.n <= l.sampling.first || (l.sampling.thereafter > 0 && (c.n-l.sampling.first)%l.sampling.thereafter == 0) {
+		dropped := c.dropped
+		c.dropped = 0
+		return true, dropped
+	}
+	c.dropped++
+	return false, 0
+}
+
+// sampled returns the template of a logged line, noting the similar lines dropped before it.
+func sampled(template string, dropped int) string {
+	if dropped == 0 {
+		return template
+	}
+	return fmt.Sprintf("%s (%d similar lines dropped)", template, dropped)
+}
+
+// Debugf logs a sampled debug line.
+func (l *sampledLogger) Debugf(template string, args ...interface{}) {
+	if ok, dropped := l.sample(template); ok {
+		l.Logger.Debugf(sampled(template, dropped), args...)
+	}
+}
+
+// Infof logs a sampled info line.
+func (l *sampledLogger) Infof(template string, args ...interface{}) {
+	if ok, dropped := l.sample(template); ok {
+		l.Logger.Infof(sampled(template, dropped), args...)
+	}
+}
+
+// Warnf logs a sampled warning.
+func (l *sampledLogger) Warnf(template string, args ...interface{}) {
+	if ok, dropped := l.sample(template); ok {
+		l.Logger.Warnf(sampled(template, dropped), args...)
+	}
+}
+
+// Errorf logs a sampled error.
+func (l *sampledLogger) Errorf(template string, args ...interface{}) {
+	if ok, dropped := l.sample(template); ok {
+		l.Logger.Errorf(sampled(template, dropped), args...)
+	}
+}
+
+// With returns a sampled logger adding the key-value pairs to every entry.
+func (l *sampledLogger) With(args ...interface{}) domain.Logger {
+	return &sampledLogger{Logger: l.Logger.With(args...), sampling: l.sampling, mu: l.mu, counts: l.counts}
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"os/signal"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/utils"
+	"time"
+)
+
+// RunWithSignals calls Run with handler until a shutdown signal is received or ctx is done, then the
+// source is closed waiting up to shutdownTimeout for the in-flight events. The signal only stops the
+// intake, the handlers keep the values of ctx but are cancelled only once shutdownTimeout expires. A nil
+// error means every event in-flight was handled before the timeout.
+func (s *SQSSource) RunWithSignals(ctx context.Context, handler domain.Handler, shutdownTimeout time.Duration) error {
+	signalCtx, stop := signal.NotifyContext(ctx, utils.ShutdownSignals...)
+	defer stop()
+	handlerCtx, cancelHandlers := context.WithCancel(detach(ctx))
+	defer cancelHandlers()
+
+	finished := make(chan struct{})
+	var runErr error
+	go func() {
+		runErr = s.Run(handlerCtx, handler)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		// closed by someone else, there is nothing left to shut down
+		return runErr
+	case <-signalCtx.Done():
+	}
+
+	s.log.Infof("Shutting down consumer, waiting up to %v for the in-flight events", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Close(shutdownCtx); err != nil {
+		return err
+	}
+	select {
+	case <-finished:
+		return nil
+	case <-shutdownCtx.Done():
+		return fmt.Errorf("error waiting for the handlers on shutdown: %w", shutdownCtx.Err())
+	}
+}
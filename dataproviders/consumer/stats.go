@@ -0,0 +1,139 @@
+package consumer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the counters of the consumer.
+type Stats struct {
+	Received      int64
+	Emitted       int64
+	Acked         int64
+	Failed        int64
+	InFlight      int64
+	DeadLettered  int64
+	LastReceiveAt time.Time
+	// PollInterval is the widest wait between receives of the queues throttled by SQS, zero when none is.
+	PollInterval time.Duration
+	// BreakerState is the state of the circuit breaker: closed, open or half-open, empty without breaker.
+	BreakerState string
+	// BatchSize is the number of messages requested on each receive, adapted with WithAdaptiveBatch.
+	BatchSize int
+	// Queues are the counters of each queue keyed by its URL, the counters above add them up.
+	Queues map[string]QueueStats
+}
+
+// QueueStats are the counters of one of the queues of the consumer.
+type QueueStats struct {
+	Received     int64
+	Acked        int64
+	Failed       int64
+	DeadLettered int64
+	// PollInterval is the wait between receives while SQS throttles the queue, zero when it doesn't.
+	PollInterval time.Duration
+}
+
+// queueCounters are the counters of a queue, updated along with the counters of the consumer.
+type queueCounters struct {
+	received     atomic.Int64
+	acked        atomic.Int64
+	failed       atomic.Int64
+	deadLettered atomic.Int64
+}
+
+// counters are updated in the hot paths of the consumer.
+type counters struct {
+	received     atomic.Int64
+	emitted      atomic.Int64
+	acked        atomic.Int64
+	failed       atomic.Int64
+	inFlight     atomic.Int64
+	deadLettered atomic.Int64
+	lastReceive  atomic.Int64
+	// lastMessage and lastProcessed are the moments of the last message received and the last
+	// event processed, in unix nanoseconds.
+	lastMessage   atomic.Int64
+	lastProcessed atomic.Int64
+}
+
+// Stats returns the counters of the consumer since it was created.
+func (s *SQSSource) Stats() Stats {
+	stats := Stats{
+		Received:     s.counters.received.Load(),
+		Emitted:      s.counters.emitted.Load(),
+		Acked:        s.counters.acked.Load(),
+		Failed:       s.counters.failed.Load(),
+		InFlight:     s.counters.inFlight.Load(),
+		DeadLettered: s.counters.deadLettered.Load(),
+		BatchSize:    s.maxMessages,
+		Queues:       make(map[string]QueueStats, len(s.queues)),
+	}
+	if s.tuner != nil {
+		stats.BatchSize = s.tuner.current()
+	}
+	if s.breaker != nil {
+		stats.BreakerState = s.breaker.State().String()
+	}
+	for _, q := range s.queues {
+		interval := q.pollInterval()
+		if interval > stats.PollInterval {
+			stats.PollInterval = interval
+		}
+		stats.Queues[q.client.URL()] = QueueStats{
+			Received:     q.counters.received.Load(),
+			Acked:        q.counters.acked.Load(),
+			Failed:       q.counters.failed.Load(),
+			DeadLettered: q.counters.deadLettered.Load(),
+			PollInterval: interval,
+		}
+	}
+	if last := s.counters.lastReceive.Load(); last != 0 {
+		stats.LastReceiveAt = time.Unix(0, last)
+	}
+	return stats
+}
+
+// countReceived counts the messages received from q.
+func (s *SQSSource) countReceived(q *queue, n int) {
+	s.counters.received.Add(int64(n))
+	q.counters.received.Add(int64(n))
+	s.metrics.MessagesReceived(q.name, n)
+}
+
+// countFailed counts a message of q that failed.
+func (s *SQSSource) countFailed(q *queue) {
+	s.counters.failed.Add(1)
+	q.counters.failed.Add(1)
+	s.metrics.MessageFailed(q.name)
+}
+
+// countDeadLettered counts a message of q moved to the DLQ.
+func (s *SQSSource) countDeadLettered(q *queue) {
+	s.counters.deadLettered.Add(1)
+	q.counters.deadLettered.Add(1)
+}
+
+// LastReceivedAt returns when the last message was received from SQS, zero before the first one. Unlike
+// the LastReceiveAt of Stats, the receives without messages don't count.
+func (s *SQSSource) LastReceivedAt() time.Time {
+	return unixTime(s.counters.lastMessage.Load())
+}
+
+// LastProcessedAt returns when the last event was processed successfully, zero before the first one.
+func (s *SQSSource) LastProcessedAt() time.Time {
+	return unixTime(s.counters.lastProcessed.Load())
+}
+
+// unixTime returns the time of nanos unix nanoseconds, zero when nanos is zero.
+func unixTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// InFlight returns the number of events produced and not yet processed.
+func (s *SQSSource) InFlight() int {
+	return int(s.counters.inFlight.Load())
+}
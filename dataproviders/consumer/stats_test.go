@@ -0,0 +1,176 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/logging"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestInFlightGauge(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	for i := 0; i < 3; i++ {
+		fake.Enqueue(testBody, nil)
+	}
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake})
+
+	events := s.Consume(context.Background())
+	produced := make([]*domain.Event, 0, 3)
+	for i := 0; i < 3; i++ {
+		produced = append(produced, nextEvent(t, events))
+	}
+	if inFlight := s.Stats().InFlight; inFlight != 3 {
+		t.Fatalf("%d events in-flight, want 3", inFlight)
+	}
+	for i, event := range produced {
+		if err := s.Processed(event); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+		if inFlight, want := s.Stats().InFlight, int64(len(produced)-i-1); inFlight != want {
+			t.Fatalf("%d events in-flight after %d acks, want %d", inFlight, i+1, want)
+		}
+	}
+	closeSource(t, s)
+}
+
+func TestInFlightWarning(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s, err := New([]awssqs.Client{fake}, logging.NewZap(zap.New(core).Sugar()), awssqs.MaxReceiveMessages, testutil.NewMemoryStore(),
+		WithEmptyPollDelay(time.Millisecond), WithInFlightWarning(2))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	events := s.Consume(context.Background())
+	first := nextEvent(t, events)
+	if err := s.Processed(first); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	if warnings := inFlightWarnings(logs); warnings != 0 {
+		t.Fatalf("%d in-flight warnings below the threshold", warnings)
+	}
+	fake.Enqueue(testBody, nil)
+	fake.Enqueue(testBody, nil)
+	second, third := nextEvent(t, events), nextEvent(t, events)
+	// the first event was acked, so the third one produced reaches the threshold
+	eventually(t, "the in-flight warning", func() bool { return inFlightWarnings(logs) == 1 })
+	if entry := logs.FilterMessageSnippet("events in-flight waiting").All()[0]; !strings.HasPrefix(entry.Message, "2 events") {
+		t.Fatalf("warning %q, want it to report 2 events", entry.Message)
+	}
+	for _, event := range []*domain.Event{second, third} {
+		if err := s.Processed(event); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	closeSource(t, s)
+}
+
+// inFlightWarnings counts the warnings logged about the in-flight events.
+func inFlightWarnings(logs *observer.ObservedLogs) int {
+	return logs.FilterMessageSnippet("events in-flight waiting").Len()
+}
+
+// namedQueue is a fake queue with its own URL, so several of them can be consumed together.
+type namedQueue struct {
+	*testutil.FakeSQS
+	url string
+}
+
+func (q namedQueue) URL() string {
+	return q.url
+}
+
+// recordingMetrics counts the metrics recorded by the consumer, keyed by metric and queue label.
+type recordingMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (m *recordingMetrics) add(metric, queue string, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[metric+"/"+queue] += n
+}
+
+func (m *recordingMetrics) count(metric, queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[metric+"/"+queue]
+}
+
+func (m *recordingMetrics) MessagesReceived(queue string, n int) { m.add("received", queue, n) }
+func (m *recordingMetrics) MessageProcessed(queue string, _ time.Duration) {
+	m.add("processed", queue, 1)
+}
+func (m *recordingMetrics) MessageFailed(queue string)             { m.add("failed", queue, 1) }
+func (m *recordingMetrics) ReceiveError(queue string)              { m.add("receive_errors", queue, 1) }
+func (m *recordingMetrics) QueueDepth(string, int64, int64, int64) {}
+
+func TestStatsByQueue(t *testing.T) {
+	orders := namedQueue{FakeSQS: testutil.NewFakeSQS(), url: "https://sqs.local/000000000000/orders"}
+	orders.Enqueue(testBody, nil)
+	orders.Enqueue(testBody, nil)
+	payments := namedQueue{FakeSQS: testutil.NewFakeSQS(), url: "https://sqs.local/000000000000/payments"}
+	payments.FailNext(testutil.OpReceive, errors.New("throttled"), 1)
+	payments.Enqueue(testBody, nil)
+	payments.Enqueue(`{"id":`, nil)
+	metrics := &recordingMetrics{counts: make(map[string]int)}
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{orders, payments}, WithMetrics(metrics), WithMalformedAction(MalformedDrop))
+
+	events := s.Consume(context.Background())
+	for i := 0; i < 3; i++ {
+		if err := s.Processed(nextEvent(t, events)); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	}
+	eventually(t, "the malformed message failed", func() bool { return s.Stats().Failed == 1 })
+
+	stats := s.Stats()
+	if stats.Received != 4 || stats.Acked != 3 {
+		t.Fatalf("%d messages received and %d acked, want 4 and 3", stats.Received, stats.Acked)
+	}
+	want := map[string]QueueStats{
+		orders.url:   {Received: 2, Acked: 2},
+		payments.url: {Received: 2, Acked: 1, Failed: 1},
+	}
+	if len(stats.Queues) != len(want) {
+		t.Fatalf("stats of %d queues, want %d", len(stats.Queues), len(want))
+	}
+	for url, queue := range want {
+		if got := stats.Queues[url]; got != queue {
+			t.Fatalf("stats of %s are %+v, want %+v", url, got, queue)
+		}
+	}
+
+	// the metrics are labeled with the name of the queue
+	for _, m := range []struct {
+		metric, queue string
+		want          int
+	}{
+		{"received", "orders", 2},
+		{"processed", "orders", 2},
+		{"failed", "orders", 0},
+		{"receive_errors", "orders", 0},
+		{"received", "payments", 2},
+		{"processed", "payments", 1},
+		{"failed", "payments", 1},
+		{"receive_errors", "payments", 1},
+	} {
+		if got := metrics.count(m.metric, m.queue); got != m.want {
+			t.Fatalf("%s of queue %s is %d, want %d", m.metric, m.queue, got, m.want)
+		}
+	}
+	closeSource(t, s)
+}
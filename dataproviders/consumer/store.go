@@ -0,0 +1,21 @@
+package consumer
+
+import (
+	"context"
+	"service-worker-sqs-postgres/core/domain"
+	"time"
+)
+
+// EventStore persists the consumed events, it's the part of the events repository the consumer uses.
+// repository.EventRepository implements it.
+type EventStore interface {
+	Insert(ctx context.Context, events *domain.Events) error
+	InsertBatch(ctx context.Context, events []*domain.Events) error
+	InsertIfNotProcessed(ctx context.Context, events *domain.Events) (bool, error)
+	MarkProcessed(ctx context.Context, ID string) error
+	UpdateStatus(ctx context.Context, ID, status, lastError string) error
+	AddAttempt(ctx context.Context, attempt *domain.Attempt, keep int) error
+	List(ctx context.Context, filter domain.EventFilter, limit, offset int) ([]*domain.Events, error)
+	DeleteOlderThan(ctx context.Context, status string, cutoff time.Time) (int64, error)
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,141 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"service-worker-sqs-postgres/core/domain"
+	"sync"
+	"time"
+)
+
+// ErrProcessTimeout is the cause of the events that weren't processed within the process timeout.
+var ErrProcessTimeout = errors.New("event not processed within the process timeout")
+
+// ErrSettled is returned when an event is acked or failed once it was already settled.
+var ErrSettled = errors.New("event already settled")
+
+// deadline is the process timeout of an in-flight event, it's empty when the process timeout is disabled.
+type deadline struct {
+	expiry *expiry
+	timer  *time.Timer
+}
+
+// expiry is the context of an event with the process timeout, it has the values of the span context of
+// the event, which is never cancelled. Its deadline is set once the event is produced, so the time waiting
+// for room in the event stream doesn't count against the timeout.
+type expiry struct {
+	context.Context
+	done    chan struct{}
+	timeout time.Duration
+
+	mu       sync.Mutex
+	deadline time.Time
+	err      error
+}
+
+// Deadline is the timeout from now until the event is produced and its timeout started.
+func (e *expiry) Deadline() (time.Time, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.deadline.IsZero() {
+		return time.Now().Add(e.timeout), true
+	}
+	return e.deadline, true
+}
+
+func (e *expiry) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *expiry) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+// cancel cancels the context with err, only the first call has effect.
+func (e *expiry) cancel(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+		close(e.done)
+	}
+}
+
+// start sets the deadline of the context to the timeout from now, once it's reached the context is
+// cancelled and expired is called.
+func (e *expiry) start(expired func()) *time.Timer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.deadline = time.Now().Add(e.timeout)
+	return time.AfterFunc(e.timeout, func() {
+		e.cancel(context.DeadlineExceeded)
+		expired()
+	})
+}
+
+// trackDeadline tracks the event until it's claimed, with the process timeout enabled the event gets
+// the context cancelled once the timeout started by armDeadline expires.
+func (s *SQSSource) trackDeadline(event *domain.Event) {
+	d := &deadline{}
+	if s.processTimeout > 0 {
+		d.expiry = &expiry{Context: event.Context, done: make(chan struct{}), timeout: s.processTimeout}
+		event.Context = d.expiry
+	}
+	s.deadlinesMu.Lock()
+	s.deadlines[event] = d
+	s.deadlinesMu.Unlock()
+}
+
+// armDeadline starts the process timeout of a produced event, once it expires the event is failed
+// as it would be in Run.
+func (s *SQSSource) armDeadline(event *domain.Event) {
+	if s.processTimeout == 0 {
+		return
+	}
+	s.deadlinesMu.Lock()
+	defer s.deadlinesMu.Unlock()
+	d, ok := s.deadlines[event]
+	if !ok {
+		return
+	}
+	d.timer = d.expiry.start(func() {
+		event.Log.Warnf("Event %s not processed within %v", event.ID, s.processTimeout)
+		visibility := 0
+		if s.leaveOnError {
+			visibility = leaveVisibility
+		}
+		if err := s.fail(event, ErrProcessTimeout, visibility); err != nil && !errors.Is(err, ErrProcessTimeout) {
+			event.Log.Errorf("Error releasing event: %v", err)
+		}
+	})
+}
+
+// claim releases the tracking of the event, it reports false when the event was already released
+// so it's only acked or failed once, and each event produced is waited for once by Close.
+func (s *SQSSource) claim(event *domain.Event) bool {
+	s.deadlinesMu.Lock()
+	d, ok := s.deadlines[event]
+	delete(s.deadlines, event)
+	s.deadlinesMu.Unlock()
+	if !ok {
+		return false
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	if d.expiry != nil {
+		d.expiry.cancel(context.Canceled)
+	}
+	return true
+}
+
+// errUnclaimed is the cause of acking or failing an event already released, by its process timeout
+// when it's enabled.
+func (s *SQSSource) errUnclaimed() error {
+	if s.processTimeout > 0 {
+		return ErrProcessTimeout
+	}
+	return ErrSettled
+}
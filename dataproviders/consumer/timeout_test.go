@@ -0,0 +1,87 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestProcessTimeoutFailsSleepingHandler(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	// the failed message is left in-flight so the event fails a single time
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithProcessTimeout(20*time.Millisecond), WithLeaveOnError())
+
+	returned := make(chan struct{})
+	done := run(t, s, func(_ context.Context, _ *domain.Event) error {
+		defer close(returned)
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	eventually(t, "the event failed", func() bool { return s.Stats().Failed == 1 })
+	<-returned
+	// give Run the time to ack the event once the handler returned
+	time.Sleep(quiet)
+	stats := s.Stats()
+	if stats.Failed != 1 || stats.Acked != 0 {
+		t.Fatalf("%d events failed and %d acked, want the timed out event failed once", stats.Failed, stats.Acked)
+	}
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted after the process timeout", deleted)
+	}
+	stop(t, s, done)
+}
+
+func TestProcessedAfterProcessTimeout(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithProcessTimeout(20*time.Millisecond), WithLeaveOnError())
+
+	events := s.Consume(context.Background())
+	event := nextEvent(t, events)
+	select {
+	case <-event.Context.Done():
+	case <-time.After(testTimeout):
+		t.Fatal("the context of the event wasn't cancelled by the process timeout")
+	}
+	eventually(t, "the event failed", func() bool { return s.Stats().Failed == 1 })
+
+	if err := s.Processed(event); !errors.Is(err, ErrProcessTimeout) {
+		t.Fatalf("late Processed returned %v, want %v", err, ErrProcessTimeout)
+	}
+	if deleted := len(fake.Deleted()); deleted != 0 {
+		t.Fatalf("%d messages deleted by a late Processed", deleted)
+	}
+	closeSource(t, s)
+}
+
+func TestProcessTimeoutStartsOnceProduced(t *testing.T) {
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(testBody, nil)
+	fake.Enqueue(testBody, nil)
+	// the second event waits for room in the stream while the first one fills it
+	s := newTestSource(t, testutil.NewMemoryStore(), []awssqs.Client{fake}, WithProcessTimeout(50*time.Millisecond), WithBufferSize(1), WithLeaveOnError())
+
+	events := s.Consume(context.Background())
+	time.Sleep(150 * time.Millisecond)
+	first := nextEvent(t, events)
+	if err := first.Context.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("context of the buffered event: %v, want %v", err, context.DeadlineExceeded)
+	}
+	second := nextEvent(t, events)
+	if err := second.Context.Err(); err != nil {
+		t.Fatalf("context of the event waiting to be produced: %v, want its timeout started once produced", err)
+	}
+	if deadline, ok := second.Context.Deadline(); !ok || time.Until(deadline) > 50*time.Millisecond {
+		t.Fatalf("deadline %v of the event, want at most the process timeout from now", deadline)
+	}
+	if err := s.Processed(second); err != nil {
+		t.Fatalf("Processed: %v", err)
+	}
+	closeSource(t, s)
+}
@@ -0,0 +1,80 @@
+package consumer
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+// tracerName is the instrumentation name of the consumer spans.
+const tracerName = "service-worker-sqs-postgres/consumer"
+
+// attributeCarrier reads the W3C trace context from the message attributes.
+type attributeCarrier map[string]*sqs.MessageAttributeValue
+
+func (c attributeCarrier) Get(key string) string {
+	if v, ok := c[key]; ok && v != nil {
+		return aws.StringValue(v.StringValue)
+	}
+	return ""
+}
+
+func (c attributeCarrier) Set(key, value string) {
+	c[key] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+}
+
+func (c attributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// detached is a context with the values of its parent that is never cancelled.
+type detached struct {
+	parent context.Context
+}
+
+func (detached) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detached) Done() <-chan struct{}               { return nil }
+func (detached) Err() error                          { return nil }
+func (d detached) Value(key interface{}) interface{} { return d.parent.Value(key) }
+
+// detach returns a context with the values of ctx that isn't cancelled with it.
+func detach(ctx context.Context) context.Context {
+	return detached{parent: ctx}
+}
+
+// startSpan starts the span of a message, it's a child of the producer span when the message carries one.
+// The span context is detached from ctx, so closing the intake doesn't cancel the handlers of its events.
+func (s *SQSSource) startSpan(ctx context.Context, q *queue, msg *sqs.Message, retry int) (context.Context, trace.Span) {
+	ctx = propagation.TraceContext{}.Extract(detach(ctx), attributeCarrier(msg.MessageAttributes))
+	return s.tracer.Start(ctx, "sqs.process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "aws_sqs"),
+			attribute.String("messaging.destination.name", q.name),
+			attribute.String("messaging.message.id", aws.StringValue(msg.MessageId)),
+			attribute.Int("messaging.retry", retry),
+		),
+	)
+}
+
+// endSpan ends the span of an event, err is recorded when it failed.
+func endSpan(ctx context.Context, err error) {
+	if ctx == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,21 @@
+package logging
+
+import (
+	"go.uber.org/zap"
+	"service-worker-sqs-postgres/core/domain"
+)
+
+// Zap adapts a zap sugared logger to domain.Logger.
+type Zap struct {
+	*zap.SugaredLogger
+}
+
+// NewZap returns the domain.Logger of a zap sugared logger.
+func NewZap(logger *zap.SugaredLogger) *Zap {
+	return &Zap{SugaredLogger: logger}
+}
+
+// With returns a logger adding the key-value pairs to every entry.
+func (z *Zap) With(args ...interface{}) domain.Logger {
+	return &Zap{SugaredLogger: z.SugaredLogger.With(args...)}
+}
@@ -8,17 +8,53 @@ import (
 // ToDomainEvents convert domain event to model the postgres events .
 func ToDomainEvents(e *entity.Events) *domain.Events {
 	return &domain.Events{
-		ID:      e.ID,
-		Message: e.Message,
-		Date:    e.Date,
+		ID:            e.ID,
+		Message:       e.Message,
+		Date:          e.Date,
+		Status:        e.Status,
+		Retry:         e.Retry,
+		LastError:     e.LastError,
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		ProcessedAt:   e.ProcessedAt,
+		CorrelationID: e.CorrelationID,
 	}
 }
 
 // ToEntityEvents convert entity event to model the postgres events .
 func ToEntityEvents(e *domain.Events) *entity.Events {
 	return &entity.Events{
-		ID:      e.ID,
-		Message: e.Message,
-		Date:    e.Date,
+		ID:            e.ID,
+		Message:       e.Message,
+		Date:          e.Date,
+		Status:        e.Status,
+		Retry:         e.Retry,
+		LastError:     e.LastError,
+		CreatedAt:     e.CreatedAt,
+		UpdatedAt:     e.UpdatedAt,
+		ProcessedAt:   e.ProcessedAt,
+		CorrelationID: e.CorrelationID,
+	}
+}
+
+// ToDomainAttempt convert model the postgres attempt to domain attempt .
+func ToDomainAttempt(a *entity.Attempts) *domain.Attempt {
+	return &domain.Attempt{
+		EventID: a.EventID,
+		Retry:   a.Retry,
+		Outcome: a.Outcome,
+		Error:   a.Error,
+		At:      a.CreatedAt,
+	}
+}
+
+// ToEntityAttempt convert domain attempt to model the postgres attempt .
+func ToEntityAttempt(a *domain.Attempt) *entity.Attempts {
+	return &entity.Attempts{
+		EventID:   a.EventID,
+		Retry:     a.Retry,
+		Outcome:   a.Outcome,
+		Error:     a.Error,
+		CreatedAt: a.At,
 	}
 }
@@ -0,0 +1,42 @@
+package mapper
+
+import (
+	"encoding/json"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/core/domain/entity"
+)
+
+// ToDomainOutbox convert model the postgres outbox to domain outbox message.
+func ToDomainOutbox(o *entity.Outbox) *domain.OutboxMessage {
+	var attributes map[string]string
+	if o.Attributes != "" {
+		_ = json.Unmarshal([]byte(o.Attributes), &attributes)
+	}
+	return &domain.OutboxMessage{
+		ID:          o.ID,
+		Body:        o.Body,
+		Attributes:  attributes,
+		Attempts:    o.Attempts,
+		LastError:   o.LastError,
+		CreatedAt:   o.CreatedAt,
+		PublishedAt: o.PublishedAt,
+	}
+}
+
+// ToEntityOutbox convert domain outbox message to model the postgres outbox, the attributes are stored as JSON.
+func ToEntityOutbox(o *domain.OutboxMessage) *entity.Outbox {
+	var attributes string
+	if len(o.Attributes) > 0 {
+		encoded, _ := json.Marshal(o.Attributes)
+		attributes = string(encoded)
+	}
+	return &entity.Outbox{
+		ID:          o.ID,
+		Body:        o.Body,
+		Attributes:  attributes,
+		Attempts:    o.Attempts,
+		LastError:   o.LastError,
+		CreatedAt:   o.CreatedAt,
+		PublishedAt: o.PublishedAt,
+	}
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus records the consumer activity in a Prometheus registry, the metrics are labeled by queue name.
+type Prometheus struct {
+	registry      *prometheus.Registry
+	received      *prometheus.CounterVec
+	processed     *prometheus.CounterVec
+	failed        *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	receiveErrors *prometheus.CounterVec
+	depth         *prometheus.GaugeVec
+}
+
+// NewPrometheus creates the consumer metrics in a new registry.
+func NewPrometheus() *Prometheus {
+	p := &Prometheus{
+		registry: prometheus.NewRegistry(),
+		received: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "messages_received_total",
+			Help: "Messages received from SQS.",
+		}, []string{"queue"}),
+		processed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "messages_processed_total",
+			Help: "Messages processed and deleted from SQS.",
+		}, []string{"queue"}),
+		failed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "messages_failed_total",
+			Help: "Messages that failed to be processed.",
+		}, []string{"queue"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "processing_duration_seconds",
+			Help:    "Time from an event is produced until it's processed.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"queue"}),
+		receiveErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "sqs_receive_errors_total",
+			Help: "Failed receives from SQS.",
+		}, []string{"queue"}),
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "sqs_queue_messages",
+			Help: "Approximate number of messages of the queue by state: visible, not_visible or delayed.",
+		}, []string{"queue", "state"}),
+	}
+	p.registry.MustRegister(p.received, p.processed, p.failed, p.duration, p.receiveErrors, p.depth)
+
+	return p
+}
+
+// Registry returns the registry holding the metrics.
+func (p *Prometheus) Registry() *prometheus.Registry {
+	return p.registry
+}
+
+// Handler returns the http handler exposing the metrics to be scraped.
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+// MessagesReceived counts the messages received from the queue.
+func (p *Prometheus) MessagesReceived(queue string, n int) {
+	p.received.WithLabelValues(queue).Add(float64(n))
+}
+
+// MessageProcessed counts a processed message and its processing time.
+func (p *Prometheus) MessageProcessed(queue string, duration time.Duration) {
+	p.processed.WithLabelValues(queue).Inc()
+	p.duration.WithLabelValues(queue).Observe(duration.Seconds())
+}
+
+// MessageFailed counts a message that failed to be processed.
+func (p *Prometheus) MessageFailed(queue string) {
+	p.failed.WithLabelValues(queue).Inc()
+}
+
+// ReceiveError counts a failed receive from the queue.
+func (p *Prometheus) ReceiveError(queue string) {
+	p.receiveErrors.WithLabelValues(queue).Inc()
+}
+
+// QueueDepth sets the approximate number of messages of the queue.
+func (p *Prometheus) QueueDepth(queue string, visible, notVisible, delayed int64) {
+	p.depth.WithLabelValues(queue, "visible").Set(float64(visible))
+	p.depth.WithLabelValues(queue, "not_visible").Set(float64(notVisible))
+	p.depth.WithLabelValues(queue, "delayed").Set(float64(delayed))
+}
@@ -0,0 +1,76 @@
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/consumer"
+	"service-worker-sqs-postgres/dataproviders/logging"
+	"service-worker-sqs-postgres/dataproviders/metrics"
+	fakes "service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func TestPrometheusProcessedMessage(t *testing.T) {
+	p := metrics.NewPrometheus()
+	fake := fakes.NewFakeSQS()
+	fake.Enqueue(`{"id":"1","message":"hello"}`, nil)
+	s, err := consumer.New([]awssqs.Client{fake}, logging.NewZap(zap.NewNop().Sugar()), awssqs.MaxReceiveMessages,
+		fakes.NewMemoryStore(), consumer.WithMetrics(p), consumer.WithEmptyPollDelay(time.Millisecond))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	select {
+	case event := <-s.Consume(context.Background()):
+		if err := s.Processed(event); err != nil {
+			t.Fatalf("Processed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event produced")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// the queue label is the name of the queue from its URL
+	expected := `
+# HELP messages_processed_total Messages processed and deleted from SQS.
+# TYPE messages_processed_total counter
+messages_processed_total{queue="fake"} 1
+# HELP messages_received_total Messages received from SQS.
+# TYPE messages_received_total counter
+messages_received_total{queue="fake"} 1
+`
+	if err := testutil.GatherAndCompare(p.Registry(), strings.NewReader(expected), "messages_received_total", "messages_processed_total"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(p.Registry(), "processing_duration_seconds"); n != 1 {
+		t.Fatalf("%d processing duration series, want 1", n)
+	}
+	if n := testutil.CollectAndCount(p.Registry(), "messages_failed_total"); n != 0 {
+		t.Fatalf("%d failed series after a processed message, want 0", n)
+	}
+}
+
+func TestPrometheusQueueDepth(t *testing.T) {
+	p := metrics.NewPrometheus()
+	p.QueueDepth("events", 3, 2, 1)
+
+	expected := `
+# HELP sqs_queue_messages Approximate number of messages of the queue by state: visible, not_visible or delayed.
+# TYPE sqs_queue_messages gauge
+sqs_queue_messages{queue="events",state="delayed"} 1
+sqs_queue_messages{queue="events",state="not_visible"} 2
+sqs_queue_messages{queue="events",state="visible"} 3
+`
+	if err := testutil.GatherAndCompare(p.Registry(), strings.NewReader(expected), "sqs_queue_messages"); err != nil {
+		t.Fatal(err)
+	}
+}
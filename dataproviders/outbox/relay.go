@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"strconv"
+	"time"
+)
+
+// Store represents the outbox operations used by the relay, the events repository implements it.
+type Store interface {
+	ClaimOutbox(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]*domain.OutboxMessage, error)
+	MarkPublished(ctx context.Context, ID string) error
+	OutboxFailed(ctx context.Context, ID, lastError string) error
+}
+
+// Relay publishes to SQS the outbox messages committed by the handlers. Each poll claims its messages for
+// a lease, so several relays don't publish the same ones. A message is published at least once: when
+// marking it fails after the publication it's published again once its lease expires, so on FIFO queues
+// its ID is the deduplication ID and SQS drops the copy.
+type Relay struct {
+	store       Store
+	sender      awssqs.Sender
+	log         domain.Logger
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	lease       time.Duration
+}
+
+// Option configures an optional behaviour of the Relay.
+type Option func(*Relay)
+
+// WithInterval sets the time between two polls of the outbox, by default 1 second.
+func WithInterval(interval time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = interval
+	}
+}
+
+// WithBatchSize sets the max number of messages published in each poll, by default 100.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// WithMaxAttempts stops retrying a message after it failed n times, it's left in the outbox with its
+// last error. By default the messages are retried until they're published.
+func WithMaxAttempts(n int) Option {
+	return func(r *Relay) {
+		r.maxAttempts = n
+	}
+}
+
+// WithLease sets how long the messages of a poll are claimed by the relay, by default 30 seconds. It
+// must be longer than a publication, the messages are published again by any relay once it expires.
+func WithLease(lease time.Duration) Option {
+	return func(r *Relay) {
+		r.lease = lease
+	}
+}
+
+// NewRelay returns a relay publishing the outbox of store with sender.
+func NewRelay(store Store, sender awssqs.Sender, logger domain.Logger, opts ...Option) (*Relay, error) {
+	r := &Relay{
+		store:     store,
+		sender:    sender,
+		log:       logger,
+		interval:  time.Second,
+		batchSize: 100,
+		lease:     30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.interval <= 0 {
+		return nil, fmt.Errorf("outbox poll interval must be greater than 0, got %v", r.interval)
+	}
+	if r.batchSize < 1 {
+		return nil, fmt.Errorf("outbox batch size must be greater than 0, got %d", r.batchSize)
+	}
+	if r.lease <= 0 {
+		return nil, fmt.Errorf("outbox lease must be greater than 0, got %v", r.lease)
+	}
+	if r.maxAttempts < 0 {
+		return nil, fmt.Errorf("outbox max attempts must not be negative, got %d", r.maxAttempts)
+	}
+	return r, nil
+}
+
+// Run polls the outbox until ctx is done, a poll that fills the batch is followed right away by the next one.
+func (r *Relay) Run(ctx context.Context) {
+	r.log.Infof("Starting outbox relay")
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		published, err := r.Publish(ctx)
+		if err != nil {
+			r.log.Errorf("error publishing the outbox: %v", err)
+		}
+		if published == r.batchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(r.interval)
+		}
+	}
+}
+
+// Publish claims a batch of pending messages, sends them and returns how many were claimed. The messages
+// SQS rejects are recorded as a failed attempt and published again in a later poll.
+func (r *Relay) Publish(ctx context.Context) (int, error) {
+	pending, err := r.store.ClaimOutbox(ctx, r.batchSize, r.maxAttempts, r.lease)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+
+	inputs := make([]awssqs.SendInput, 0, len(pending))
+	for i, msg := range pending {
+		inputs = append(inputs, awssqs.SendInput{
+			ID:              strconv.Itoa(i),
+			Body:            msg.Body,
+			Attributes:      msg.Attributes,
+			DeduplicationID: msg.ID,
+		})
+	}
+	results, sendErr := r.sender.SendMessageBatch(ctx, inputs)
+	sent := make(map[string]error, len(results))
+	for _, result := range results {
+		sent[result.ID] = result.Err
+	}
+
+	for i, msg := range pending {
+		cause, ok := sent[strconv.Itoa(i)]
+		if !ok {
+			cause = fmt.Errorf("not sent: %w", sendErr)
+		}
+		if cause != nil {
+			r.log.Warnf("Outbox message %s not published (attempt %d): %v", msg.ID, msg.Attempts+1, cause)
+			if err := r.store.OutboxFailed(ctx, msg.ID, cause.Error()); err != nil {
+				r.log.Errorf("error recording the failure of outbox message %s: %v", msg.ID, err)
+			}
+			continue
+		}
+		if err := r.store.MarkPublished(ctx, msg.ID); err != nil {
+			r.log.Errorf("error marking outbox message %s as published, it will be published again: %v", msg.ID, err)
+		}
+	}
+	return len(pending), sendErr
+}
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"service-worker-sqs-postgres/core/domain"
+	"time"
+)
+
+// queryLogger is the gorm logger of the client, it logs the failed queries as errors and the queries
+// slower than the slow threshold as warnings.
+type queryLogger struct {
+	log   domain.Logger
+	slow  time.Duration
+	level logger.LogLevel
+}
+
+// newQueryLogger returns a gorm logger writing to log, a zero slow threshold doesn't log the slow queries.
+func newQueryLogger(log domain.Logger, slow time.Duration) *queryLogger {
+	return &queryLogger{log: log, slow: slow, level: logger.Warn}
+}
+
+// LogMode returns a logger with level.
+func (l *queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	copied := *l
+	copied.level = level
+	return &copied
+}
+
+// Info logs an info message of gorm.
+func (l *queryLogger) Info(_ context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		l.log.Infof(msg, args...)
+	}
+}
+
+// Warn logs a warning of gorm.
+func (l *queryLogger) Warn(_ context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		l.log.Warnf(msg, args...)
+	}
+}
+
+// Error logs an error of gorm.
+func (l *queryLogger) Error(_ context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		l.log.Errorf(msg, args...)
+	}
+}
+
+// Trace logs a query once it ran, a record not found isn't an error.
+func (l *queryLogger) Trace(_ context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		sql, rows := fc()
+		l.log.Errorf("Error in query after %v (%d rows): %s: %v", elapsed, rows, sql, err)
+	case l.slow > 0 && elapsed > l.slow && l.level >= logger.Warn:
+		sql, rows := fc()
+		l.log.Warnf("Slow query took %v, over the threshold of %v (%d rows): %s", elapsed, l.slow, rows, sql)
+	case l.level >= logger.Info:
+		sql, rows := fc()
+		l.log.Debugf("Query took %v (%d rows): %s", elapsed, rows, sql)
+	}
+}
@@ -1,20 +1,108 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-	_ "gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+	"service-worker-sqs-postgres/core/domain"
 	"service-worker-sqs-postgres/core/domain/entity"
 	"time"
 )
 
 // ClientDB represents DB client.
 type ClientDB struct {
-	DB     *gorm.DB
-	params Params
+	DB       *gorm.DB
+	params   Params
+	config   Config
+	resolver *dbresolver.DBResolver
+}
+
+// The database drivers of the client.
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+)
+
+// Config is the connection pool configuration.
+type Config struct {
+	// Driver is the database of the connection, DriverPostgres or DriverMySQL, by default DriverPostgres.
+	Driver string
+	// SSLMode is the encryption of the connection as the sslmode of postgres, by default SSLPrefer.
+	SSLMode string
+	// SSLRootCert is the path of the CA certificates verifying the server, the system ones when empty.
+	SSLRootCert string
+	// SSLCert and SSLKey are the paths of the client certificate and its key, if the server requires one.
+	SSLCert string
+	SSLKey  string
+	// MaxOpenConns is the max number of open connections, by default 10.
+	MaxOpenConns int
+	// MaxIdleConns is the max number of idle connections kept in the pool, by default 5.
+	MaxIdleConns int
+	// ConnMaxLifetime is the max time a connection is reused, by default 5 minutes.
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime is the max time a connection stays idle before it's closed, by default 5 minutes.
+	ConnMaxIdleTime time.Duration
+	// EventsTable is the name of the table of the events, by default events.
+	EventsTable string
+	// Replicas are the hosts of the read replicas as host or host:port, they share the credentials,
+	// the database and the TLS settings of the primary. Without port the port of the primary is used.
+	Replicas []string
+	// Logger receives the failed and the slow queries, they aren't logged when it's nil.
+	Logger domain.Logger
+	// SlowQueryThreshold is the duration over which a query is logged as a warning, by default 200ms.
+	// Zero disables it.
+	SlowQueryThreshold time.Duration
+}
+
+// DefaultConfig returns the default connection pool configuration.
+func DefaultConfig() Config {
+	return Config{
+		Driver:          DriverPostgres,
+		SSLMode:         SSLPrefer,
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 5 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+		EventsTable:     entity.Events{}.TableName(),
+
+		SlowQueryThreshold: 200 * time.Millisecond,
+	}
+}
+
+// Validate checks the connection pool configuration.
+func (c Config) Validate() error {
+	if c.Driver != DriverPostgres && c.Driver != DriverMySQL {
+		return fmt.Errorf("unknown database driver %q, it must be %s or %s", c.Driver, DriverPostgres, DriverMySQL)
+	}
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+	if c.MaxOpenConns < 1 {
+		return fmt.Errorf("max open connections must be greater than 0, got %d", c.MaxOpenConns)
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("max idle connections must be between 0 and the max open connections %d, got %d", c.MaxOpenConns, c.MaxIdleConns)
+	}
+	if c.EventsTable == "" {
+		return errors.New("events table name must not be empty")
+	}
+	for _, replica := range c.Replicas {
+		if replica == "" {
+			return errors.New("replica host must not be empty")
+		}
+	}
+	if c.SlowQueryThreshold < 0 {
+		return fmt.Errorf("slow query threshold must not be negative, got %v", c.SlowQueryThreshold)
+	}
+	if c.ConnMaxLifetime < 0 || c.ConnMaxIdleTime < 0 {
+		return fmt.Errorf("connection max lifetime %v and max idle time %v must not be negative", c.ConnMaxLifetime, c.ConnMaxIdleTime)
+	}
+	return nil
 }
 
 type Params struct {
@@ -25,8 +113,17 @@ type Params struct {
 	port     string
 }
 
-// NewDBClient instances of a Client to connect postgresql with parameters.
-func NewDBClient(host, username, password, name, port string) *ClientDB {
+// NewDBClient instances of a Client to connect postgresql with parameters and the connection pool configuration.
+func NewDBClient(host, username, password, name, port string, config Config) (*ClientDB, error) {
+	if config.Driver == "" {
+		config.Driver = DriverPostgres
+	}
+	if config.SSLMode == "" {
+		config.SSLMode = SSLPrefer
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid postgres config: %w", err)
+	}
 	return &ClientDB{
 		params: Params{
 			host:     host,
@@ -35,28 +132,62 @@ func NewDBClient(host, username, password, name, port string) *ClientDB {
 			name:     name,
 			port:     port,
 		},
-	}
+		config: config,
+	}, nil
 }
 
-// Open the postgres connection only the first time. The next times, it maintains the same connection.
-func (client *ClientDB) Open() error {
-
-	connString := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		client.params.host,
+// dialector returns the gorm dialector of the driver of the client connecting to host and port.
+func (client *ClientDB) dialector(host, port string) (gorm.Dialector, error) {
+	if client.config.Driver == DriverMySQL {
+		tlsParam, err := client.config.mysqlTLS(host)
+		if err != nil {
+			return nil, err
+		}
+		return mysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=true&loc=UTC&tls=%s",
+			client.params.userName,
+			client.params.password,
+			host,
+			port,
+			client.params.name,
+			tlsParam)), nil
+	}
+	return postgres.Open(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s",
+		host,
 		client.params.userName,
 		client.params.password,
 		client.params.name,
-		client.params.port)
+		port) + client.config.postgresTLS()), nil
+}
 
+// Open the database connection only the first time. The next times, it maintains the same connection.
+func (client *ClientDB) Open() error {
 	if client.DB == nil {
-		db, err := gorm.Open(postgres.Open(connString), &gorm.Config{
+		dialector, err := client.dialector(client.params.host, client.params.port)
+		if err != nil {
+			return errors.Wrapf(err, "Error configuring database tls: %v", err.Error())
+		}
+		queries := logger.Default.LogMode(logger.Silent)
+		if client.config.Logger != nil {
+			queries = newQueryLogger(client.config.Logger, client.config.SlowQueryThreshold)
+		}
+		db, err := gorm.Open(dialector, &gorm.Config{
 			SkipDefaultTransaction: true,
-			Logger:                 logger.Default.LogMode(logger.Silent),
+			Logger:                 queries,
 			CreateBatchSize:        1000,
 		})
 		if err != nil {
 			return errors.Wrapf(err, "Error opening postgres file: %v", err.Error())
 		}
+		if len(client.config.Replicas) > 0 {
+			if client.resolver, err = client.useReplicas(db); err != nil {
+				return errors.Wrapf(err, "Error opening postgres replicas: %v", err.Error())
+			}
+			client.resolver.
+				SetConnMaxLifetime(client.config.ConnMaxLifetime).
+				SetConnMaxIdleTime(client.config.ConnMaxIdleTime).
+				SetMaxOpenConns(client.config.MaxOpenConns).
+				SetMaxIdleConns(client.config.MaxIdleConns)
+		}
 
 		dbs := db.Session(&gorm.Session{CreateBatchSize: 1000})
 		sqlDB, err := dbs.DB()
@@ -64,17 +195,132 @@ func (client *ClientDB) Open() error {
 			return errors.Wrapf(err, "Error instance postgres : %v", err.Error())
 		}
 
-		sqlDB.SetConnMaxLifetime(5 * time.Minute)
-		sqlDB.SetConnMaxIdleTime(10)
-		sqlDB.SetMaxOpenConns(10)
+		sqlDB.SetConnMaxLifetime(client.config.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(client.config.ConnMaxIdleTime)
+		sqlDB.SetMaxOpenConns(client.config.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(client.config.MaxIdleConns)
 
-		err = dbs.AutoMigrate(entity.Events{})
-		if err != nil {
-			return errors.Wrapf(err, "Error migrating postgres : %v", err.Error())
+		client.DB = dbs
+	}
+
+	return nil
+}
+
+// Ping checks the database responds.
+func (client *ClientDB) Ping(ctx context.Context) error {
+	if client.DB == nil {
+		return errors.New("postgres connection isn't open")
+	}
+	sqlDB, err := client.DB.DB()
+	if err != nil {
+		return errors.Wrapf(err, "Error instance postgres : %v", err.Error())
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// WithTransaction runs fn in a transaction, tx is a client scoped to the transaction. The transaction
+// is committed when fn returns nil, otherwise it's rolled back and the error of fn is returned.
+func (client *ClientDB) WithTransaction(ctx context.Context, fn func(tx *ClientDB) error) error {
+	if client.DB == nil {
+		return errors.New("postgres connection isn't open")
+	}
+	return client.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&ClientDB{DB: tx, params: client.params, config: client.config, resolver: client.resolver})
+	})
+}
+
+// Driver returns the database driver of the client.
+func (client *ClientDB) Driver() string {
+	return client.config.Driver
+}
+
+// EventsTable returns the name of the table of the events.
+func (client *ClientDB) EventsTable() string {
+	return client.config.EventsTable
+}
+
+// migration is an entity of the service and the table Migrate creates for it.
+type migration struct {
+	table string
+	model interface{}
+}
+
+// migrations returns the entities of the service on their configured tables.
+func (client *ClientDB) migrations() []migration {
+	return []migration{
+		{table: client.EventsTable(), model: &entity.Events{}},
+		{table: entity.Outbox{}.TableName(), model: &entity.Outbox{}},
+		{table: entity.Attempts{}.TableName(), model: &entity.Attempts{}},
+	}
+}
+
+// PendingMigrations describes the tables and columns of the entities that Migrate would create.
+func (client *ClientDB) PendingMigrations() ([]string, error) {
+	if client.DB == nil {
+		return nil, errors.New("postgres connection isn't open")
+	}
+	var changes []string
+	for _, m := range client.migrations() {
+		migrator := client.DB.Table(m.table).Migrator()
+		if !migrator.HasTable(m.model) {
+			changes = append(changes, fmt.Sprintf("create table %s", m.table))
+			continue
 		}
 
-		client.DB = dbs
+		stmt := &gorm.Statement{DB: client.DB}
+		if err := stmt.Parse(m.model); err != nil {
+			return nil, errors.Wrapf(err, "Error parsing model : %v", err.Error())
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !migrator.HasColumn(m.model, field.DBName) {
+				changes = append(changes, fmt.Sprintf("add column %s.%s", m.table, field.DBName))
+			}
+		}
 	}
+	return changes, nil
+}
 
+// AutoMigrate creates the missing tables, columns and indexes of models, running it again on an
+// up to date schema changes nothing.
+func (client *ClientDB) AutoMigrate(models ...interface{}) error {
+	if client.DB == nil {
+		return errors.New("postgres connection isn't open")
+	}
+	if err := client.DB.AutoMigrate(models...); err != nil {
+		return errors.Wrapf(err, "Error migrating postgres : %v", err.Error())
+	}
+	return nil
+}
+
+// Migrate applies AutoMigrate to the entities of the service on their configured tables.
+func (client *ClientDB) Migrate() error {
+	if client.DB == nil {
+		return errors.New("postgres connection isn't open")
+	}
+	for _, m := range client.migrations() {
+		if err := client.DB.Table(m.table).AutoMigrate(m.model); err != nil {
+			return errors.Wrapf(err, "Error migrating postgres : %v", err.Error())
+		}
+	}
+	return nil
+}
+
+// Close closes the connection pool, the client can be opened again afterwards.
+func (client *ClientDB) Close() error {
+	if client.DB == nil {
+		return nil
+	}
+	sqlDB, err := client.DB.DB()
+	if err != nil {
+		return errors.Wrapf(err, "Error instance postgres : %v", err.Error())
+	}
+	if err = client.closeReplicas(sqlDB); err != nil {
+		return errors.Wrapf(err, "Error closing postgres replicas : %v", err.Error())
+	}
+	client.resolver = nil
+	if err = sqlDB.Close(); err != nil {
+		return errors.Wrapf(err, "Error closing postgres : %v", err.Error())
+	}
+	client.DB = nil
 	return nil
 }
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"net"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// primaryKey is the context key of WithPrimary.
+type primaryKey struct{}
+
+// WithPrimary returns a context whose queries run on the primary even when there are replicas, for
+// the reads that must see a write just made.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// Conn returns the connection scoped to ctx. With replicas the queries run on one of them and the
+// writes and transactions on the primary, unless ctx comes from WithPrimary.
+func (client *ClientDB) Conn(ctx context.Context) *gorm.DB {
+	db := client.DB.WithContext(ctx)
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		db = db.Clauses(dbresolver.Write)
+	}
+	return db
+}
+
+// replicaAddr returns the host and port of a replica, a replica without port uses the port of the primary.
+func (client *ClientDB) replicaAddr(replica string) (string, string) {
+	host, port, err := net.SplitHostPort(replica)
+	if err != nil {
+		return replica, client.params.port
+	}
+	return host, port
+}
+
+// useReplicas registers the replicas in db, the reads are balanced randomly between them.
+func (client *ClientDB) useReplicas(db *gorm.DB) (*dbresolver.DBResolver, error) {
+	replicas := make([]gorm.Dialector, 0, len(client.config.Replicas))
+	for _, replica := range client.config.Replicas {
+		host, port := client.replicaAddr(replica)
+		dialector, err := client.dialector(host, port)
+		if err != nil {
+			return nil, err
+		}
+		replicas = append(replicas, dialector)
+	}
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: replicas,
+		Policy:   dbresolver.RandomPolicy{},
+	})
+	if err := db.Use(resolver); err != nil {
+		return nil, err
+	}
+	return resolver, nil
+}
+
+// closeReplicas closes the connection pools of the replicas, primary is closed by the caller.
+func (client *ClientDB) closeReplicas(primary gorm.ConnPool) error {
+	if client.resolver == nil {
+		return nil
+	}
+	return client.resolver.Call(func(pool gorm.ConnPool) error {
+		if closer, ok := pool.(interface{ Close() error }); ok && pool != primary {
+			return closer.Close()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/core/domain/entity"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+	"service-worker-sqs-postgres/dataproviders/mapper"
+	"service-worker-sqs-postgres/dataproviders/postgres"
+	"time"
+)
+
+// attempts returns a statement on the table of the attempts.
+func (er *EventRepository) attempts(ctx context.Context) *gorm.DB {
+	return er.db.Conn(ctx).Table(entity.Attempts{}.TableName())
+}
+
+// AddAttempt appends an attempt to the history of its event keeping the last keep ones, zero keeps them all.
+// The history is pruned by its rows whatever the retry of the attempt, a redelivery or a restored event may
+// record attempts with a retry that doesn't match how many the event has.
+func (er *EventRepository) AddAttempt(ctx context.Context, attempt *domain.Attempt, keep int) error {
+	row := mapper.ToEntityAttempt(attempt)
+	if row.CreatedAt.IsZero() {
+		row.CreatedAt = time.Now().UTC()
+	}
+	if err := er.attempts(ctx).Create(row).Error; err != nil {
+		return classify(err)
+	}
+	if keep <= 0 {
+		return nil
+	}
+
+	// the id of the newest attempt that isn't kept, a limited subquery isn't portable to mysql
+	var oldest []uint
+	err := er.attempts(postgres.WithPrimary(ctx)).
+		Where("event_id = ?", attempt.EventID).
+		Order("id DESC").
+		Offset(keep).
+		Limit(1).
+		Pluck("id", &oldest).Error
+	if err != nil || len(oldest) == 0 {
+		return classify(err)
+	}
+	return classify(er.attempts(ctx).
+		Where("event_id = ? AND id <= ?", attempt.EventID, oldest[0]).
+		Delete(&entity.Attempts{}).Error)
+}
+
+// Attempts returns the history of the attempts of an event, the oldest first.
+func (er *EventRepository) Attempts(ctx context.Context, eventID string) ([]*domain.Attempt, error) {
+	var rows []*entity.Attempts
+
+	err := er.attempts(ctx).
+		Where("event_id = ?", eventID).
+		Order("id").
+		Find(&rows).Error
+	if err != nil {
+		return nil, exceptions.ErrInternalError
+	}
+
+	result := make([]*domain.Attempt, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, mapper.ToDomainAttempt(row))
+	}
+	return result, nil
+}
@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"errors"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the postgres error code of a duplicated key.
+const uniqueViolation = "23505"
+
+// mysqlDuplicateEntry is the mysql error number of a duplicated key.
+const mysqlDuplicateEntry = 1062
+
+// mysqlIntegrityErrors are the mysql error numbers of the other integrity violations: a column
+// without value and a foreign key without parent or with children.
+var mysqlIntegrityErrors = map[uint16]bool{
+	1048: true,
+	1364: true,
+	1451: true,
+	1452: true,
+}
+
+// classify wraps err with the exceptions kind matching the failure of postgres or mysql: a duplicated key is
+// exceptions.ErrEntityAlreadyExist, the other integrity violations exceptions.ErrInvalidEntity and a
+// transient failure exceptions.ErrUnavailable. The error of the database is kept in the chain.
+func classify(err error) error {
+	var pgErr *pgconn.PgError
+	var myErr *mysql.MySQLError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &pgErr) && pgErr.Code == uniqueViolation,
+		errors.As(err, &myErr) && myErr.Number == mysqlDuplicateEntry:
+		return exceptions.Wrap(exceptions.ErrEntityAlreadyExist, err)
+	case errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23"),
+		errors.As(err, &myErr) && mysqlIntegrityErrors[myErr.Number]:
+		// class 23 are integrity constraint violations
+		return exceptions.Wrap(exceptions.ErrInvalidEntity, err)
+	case isTransient(err):
+		return exceptions.Wrap(exceptions.ErrUnavailable, err)
+	default:
+		return err
+	}
+}
@@ -1,37 +1,86 @@
 package repository
 
 import (
+	"context"
+
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"service-worker-sqs-postgres/core/domain"
 	"service-worker-sqs-postgres/core/domain/entity"
 	"service-worker-sqs-postgres/core/domain/exceptions"
 	"service-worker-sqs-postgres/dataproviders/mapper"
 	"service-worker-sqs-postgres/dataproviders/postgres"
+	"time"
 )
 
+// upsert overwrites a redelivered event keeping its creation time and its last error.
+var upsert = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "id"}},
+	DoUpdates: clause.AssignmentColumns([]string{"message", "date", "status", "retry", "correlation_id", "updated_at"}),
+}
+
+// batchUpsert overwrites a redelivered event as upsert but keeps its status, so a duplicate inserted with
+// a batch doesn't take a processed event back to received.
+var batchUpsert = clause.OnConflict{
+	Columns:   []clause.Column{{Name: "id"}},
+	DoUpdates: clause.AssignmentColumns([]string{"message", "date", "retry", "correlation_id", "updated_at"}),
+}
+
+// insertBatchSize is the max number of events in each statement of InsertBatch.
+const insertBatchSize = 100
+
+// deleteBatchSize is the max number of events removed by each statement of DeleteOlderThan.
+const deleteBatchSize = 1000
+
 // IEventRepository interface by repository.
 type IEventRepository interface {
 	GetID(ID string) (*domain.Events, error)
-	Insert(events *domain.Events) error
+	GetByID(ctx context.Context, ID string) (*domain.Events, error)
+	List(ctx context.Context, filter domain.EventFilter, limit, offset int) ([]*domain.Events, error)
+	Insert(ctx context.Context, events *domain.Events) error
+	InsertBatch(ctx context.Context, events []*domain.Events) error
+	InsertIfNotProcessed(ctx context.Context, events *domain.Events) (bool, error)
+	MarkProcessed(ctx context.Context, ID string) error
+	UpdateStatus(ctx context.Context, ID, status, lastError string) error
+	QueryFailed(ctx context.Context, limit int) ([]*domain.Events, error)
+	DeleteOlderThan(ctx context.Context, status string, cutoff time.Time) (int64, error)
+	Ping(ctx context.Context) error
+	WithTransaction(ctx context.Context, fn func(tx Transaction) error) error
+	AddAttempt(ctx context.Context, attempt *domain.Attempt, keep int) error
+	Attempts(ctx context.Context, eventID string) ([]*domain.Attempt, error)
+}
+
+// Transaction is the repository scoped to a transaction of WithTransaction, with the events and the outbox.
+type Transaction interface {
+	IEventRepository
+	IOutboxRepository
 }
 
 // EventRepository encapsulates all the data needed to the persistence in the event table.
 type EventRepository struct {
-	db *postgres.ClientDB
+	db         *postgres.ClientDB
+	maxRetries int
 }
 
-// NewEventRepository instance the connection to the postgres.
-func NewEventRepository(db *postgres.ClientDB) *EventRepository {
+// NewEventRepository instance the connection to the postgres, the inserts failed by a transient
+// error are retried up to maxRetries times.
+func NewEventRepository(db *postgres.ClientDB, maxRetries int) *EventRepository {
 	return &EventRepository{
-		db: db,
+		db:         db,
+		maxRetries: maxRetries,
 	}
 }
 
+// table returns a statement on the table of the events.
+func (er *EventRepository) table(ctx context.Context) *gorm.DB {
+	return er.db.Conn(ctx).Table(er.db.EventsTable())
+}
+
 // GetID return the event by ID.
 func (er *EventRepository) GetID(ID string) (*domain.Events, error) {
 	event := &entity.Events{}
 
-	err := er.db.DB.Model(&event).Where("id = ?", ID).Scan(&event).Error
+	err := er.db.DB.Table(er.db.EventsTable()).Model(&event).Where("id = ?", ID).Scan(&event).Error
 	if err != nil {
 		return nil, exceptions.ErrInternalError
 	}
@@ -39,17 +88,185 @@ func (er *EventRepository) GetID(ID string) (*domain.Events, error) {
 	return mapper.ToDomainEvents(event), nil
 }
 
-// Insert records an event in the database.
-func (er *EventRepository) Insert(events *domain.Events) error {
+// GetByID return the event by ID, exceptions.ErrNotFound when it doesn't exist.
+func (er *EventRepository) GetByID(ctx context.Context, ID string) (*domain.Events, error) {
+	var events []*entity.Events
+
+	err := er.table(ctx).Where("id = ?", ID).Limit(1).Find(&events).Error
+	if err != nil {
+		return nil, exceptions.ErrInternalError
+	}
+	if len(events) == 0 {
+		return nil, exceptions.ErrNotFound
+	}
+
+	return mapper.ToDomainEvents(events[0]), nil
+}
+
+// List returns the events matching filter, the most recent first.
+func (er *EventRepository) List(ctx context.Context, filter domain.EventFilter, limit, offset int) ([]*domain.Events, error) {
+	var events []*entity.Events
+
+	query := er.table(ctx)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("date <= ?", filter.To)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.
+		Order("date DESC").
+		Offset(offset).
+		Find(&events).Error
+	if err != nil {
+		return nil, exceptions.ErrInternalError
+	}
+
+	result := make([]*domain.Events, 0, len(events))
+	for _, event := range events {
+		result = append(result, mapper.ToDomainEvents(event))
+	}
+	return result, nil
+}
+
+// Insert records an event in the database. The upsert is a single statement, so a failed insert
+// leaves no partial state and there is nothing to roll back, the error of the database is returned.
+func (er *EventRepository) Insert(ctx context.Context, events *domain.Events) error {
 
 	event := mapper.ToEntityEvents(events)
 
-	r := er.db.DB.Clauses(clause.OnConflict{
-		UpdateAll: true,
-	}).Create(&event)
-	if r.Error != nil {
-		r.Rollback()
-		return r.Error
+	return er.withRetry(ctx, func() error {
+		return er.table(ctx).Clauses(upsert).Create(&event).Error
+	})
+}
+
+// InsertBatch records several events in a single transaction, the redelivered events are overwritten as
+// in Insert but keep their status. When a chunk fails the whole batch is rolled back and the error is returned.
+func (er *EventRepository) InsertBatch(ctx context.Context, events []*domain.Events) error {
+	if len(events) == 0 {
+		return nil
+	}
+	batch := make([]*entity.Events, 0, len(events))
+	for _, event := range events {
+		batch = append(batch, mapper.ToEntityEvents(event))
 	}
-	return nil
+
+	return er.withRetry(ctx, func() error {
+		return er.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return tx.Table(er.db.EventsTable()).Clauses(batchUpsert).CreateInBatches(batch, insertBatchSize).Error
+		})
+	})
+}
+
+// InsertIfNotProcessed records an event unless it was already processed, which is reported as true.
+// The check and the insert run in a single transaction locking the stored event.
+func (er *EventRepository) InsertIfNotProcessed(ctx context.Context, events *domain.Events) (bool, error) {
+	processed := false
+	err := er.withRetry(ctx, func() error {
+		return er.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			stored := &entity.Events{}
+			r := tx.Table(er.db.EventsTable()).Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", events.ID).Limit(1).Find(stored)
+			if r.Error != nil {
+				return r.Error
+			}
+			if r.RowsAffected > 0 && stored.Status == domain.StatusProcessed {
+				processed = true
+				return nil
+			}
+			return tx.Table(er.db.EventsTable()).Clauses(upsert).Create(mapper.ToEntityEvents(events)).Error
+		})
+	})
+
+	return processed, err
+}
+
+// MarkProcessed records the moment the event was processed and sets its status to processed.
+func (er *EventRepository) MarkProcessed(ctx context.Context, ID string) error {
+	return classify(er.table(ctx).
+		Model(&entity.Events{}).
+		Where("id = ?", ID).
+		Updates(map[string]interface{}{
+			"status":       domain.StatusProcessed,
+			"processed_at": time.Now().UTC(),
+		}).Error)
+}
+
+// UpdateStatus sets the status of the event, lastError is only recorded when it isn't empty.
+func (er *EventRepository) UpdateStatus(ctx context.Context, ID, status, lastError string) error {
+	values := map[string]interface{}{"status": status}
+	if lastError != "" {
+		values["last_error"] = lastError
+	}
+
+	return classify(er.table(ctx).
+		Model(&entity.Events{}).
+		Where("id = ?", ID).
+		Updates(values).Error)
+}
+
+// QueryFailed returns the events with an error, the most retried first.
+func (er *EventRepository) QueryFailed(ctx context.Context, limit int) ([]*domain.Events, error) {
+	var events []*entity.Events
+
+	err := er.table(ctx).
+		Where("last_error <> ''").
+		Order("retry DESC").
+		Order("updated_at DESC").
+		Limit(limit).
+		Find(&events).Error
+	if err != nil {
+		return nil, exceptions.ErrInternalError
+	}
+
+	result := make([]*domain.Events, 0, len(events))
+	for _, event := range events {
+		result = append(result, mapper.ToDomainEvents(event))
+	}
+	return result, nil
+}
+
+// DeleteOlderThan removes the events with status dated before cutoff and returns how many were removed.
+// The events are removed in batches, so a large purge doesn't hold the locks of a single long statement.
+func (er *EventRepository) DeleteOlderThan(ctx context.Context, status string, cutoff time.Time) (int64, error) {
+	var deleted int64
+	for {
+		var r *gorm.DB
+		if er.db.Driver() == postgres.DriverMySQL {
+			// mysql can't delete from a subquery of the same table, but it limits the delete itself
+			r = er.table(ctx).Where("status = ? AND date < ?", status, cutoff).Limit(deleteBatchSize).Delete(&entity.Events{})
+		} else {
+			ids := er.table(ctx).
+				Select("id").
+				Where("status = ? AND date < ?", status, cutoff).
+				Limit(deleteBatchSize)
+			r = er.table(ctx).Where("id IN (?)", ids).Delete(&entity.Events{})
+		}
+		if r.Error != nil {
+			return deleted, classify(r.Error)
+		}
+		deleted += r.RowsAffected
+		if r.RowsAffected < deleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// Ping checks the database responds.
+func (er *EventRepository) Ping(ctx context.Context) error {
+	return er.db.Ping(ctx)
+}
+
+// WithTransaction runs fn with a repository scoped to a transaction, so a business write and the status
+// of the event are committed together. The transaction is rolled back when fn returns an error, and the
+// operations in it aren't retried since a failed statement aborts the transaction.
+func (er *EventRepository) WithTransaction(ctx context.Context, fn func(tx Transaction) error) error {
+	return er.db.WithTransaction(ctx, func(tx *postgres.ClientDB) error {
+		return fn(NewEventRepository(tx, 0))
+	})
 }
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	gormpostgres "gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/postgres"
+)
+
+// newMockRepository creates a repository on a mocked postgres connection, no insert is retried.
+func newMockRepository(t *testing.T) (*EventRepository, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client, err := postgres.NewDBClient("localhost", "user", "password", "events", "5432", postgres.DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewDBClient: %v", err)
+	}
+	client.DB, err = gorm.Open(gormpostgres.New(gormpostgres.Config{Conn: conn}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("gorm: %v", err)
+	}
+	return NewEventRepository(client, 0), mock
+}
+
+// testEvents returns n events with consecutive IDs.
+func testEvents(n int) []*domain.Events {
+	events := make([]*domain.Events, 0, n)
+	for i := 0; i < n; i++ {
+		events = append(events, &domain.Events{ID: strconv.Itoa(i), Message: "hello", Date: time.Now(), Status: domain.StatusProcessing})
+	}
+	return events
+}
+
+func TestInsertReturnsDatabaseError(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	failure := errors.New("relation \"events\" does not exist")
+	mock.ExpectExec(`INSERT INTO "events"`).WillReturnError(failure)
+
+	if err := repo.Insert(context.Background(), testEvents(1)[0]); !errors.Is(err, failure) {
+		t.Fatalf("Insert returned %v, want the error of the database", err)
+	}
+	// the single statement upsert opens no transaction to roll back
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertBatchRollsBackFailedChunk(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	failure := errors.New("value too long for type character varying")
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "events"`).WillReturnResult(sqlmock.NewResult(0, insertBatchSize))
+	mock.ExpectExec(`INSERT INTO "events"`).WillReturnError(failure)
+	mock.ExpectRollback()
+
+	// the second chunk fails, so the first one inserted in the transaction is rolled back
+	if err := repo.InsertBatch(context.Background(), testEvents(insertBatchSize+1)); !errors.Is(err, failure) {
+		t.Fatalf("InsertBatch returned %v, want the error of the database", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInsertBatchCommits(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	// the redelivered events keep their status
+	mock.ExpectExec(`INSERT INTO "events" .* ON CONFLICT \("id"\) DO UPDATE SET "message"="excluded"."message","date"="excluded"."date","retry"=`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectCommit()
+
+	if err := repo.InsertBatch(context.Background(), testEvents(3)); err != nil {
+		t.Fatalf("InsertBatch: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimOutboxLocksTheClaimedRows(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "outbox" WHERE published_at IS NULL AND \(locked_until IS NULL OR locked_until < \$1\) ORDER BY created_at LIMIT 10 FOR UPDATE SKIP LOCKED`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "body"}).AddRow("1", "hello"))
+	mock.ExpectExec(`UPDATE "outbox" SET "locked_until"=\$1 WHERE id IN \(\$2\)`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	claimed, err := repo.ClaimOutbox(context.Background(), 10, 0, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutbox: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID != "1" {
+		t.Fatalf("claimed %v, want the pending message", claimed)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddAttemptPrunesWhateverTheRetry(t *testing.T) {
+	repo, mock := newMockRepository(t)
+	mock.ExpectQuery(`INSERT INTO "event_attempts"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(`SELECT "id" FROM "event_attempts" WHERE event_id = \$1 ORDER BY id DESC LIMIT 1 OFFSET 2`).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(`DELETE FROM "event_attempts" WHERE event_id = \$1 AND id <= \$2`).
+		WithArgs("1", 2).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	attempt := &domain.Attempt{EventID: "1", Retry: 0, Outcome: domain.AttemptRetried}
+	if err := repo.AddAttempt(context.Background(), attempt, 2); err != nil {
+		t.Fatalf("AddAttempt: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
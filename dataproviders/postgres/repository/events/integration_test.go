@@ -0,0 +1,280 @@
+//go:build integration
+
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/core/domain/entity"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+	"service-worker-sqs-postgres/dataproviders/postgres"
+)
+
+// integrationDB is the client of the postgres container shared by the integration tests.
+var integrationDB *postgres.ClientDB
+
+func TestMain(m *testing.M) {
+	os.Exit(runWithPostgres(m))
+}
+
+// runWithPostgres runs the tests against a postgres container migrated by Migrate.
+func runWithPostgres(m *testing.M) int {
+	ctx := context.Background()
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        "postgres:15-alpine",
+			ExposedPorts: []string{"5432/tcp"},
+			Env: map[string]string{
+				"POSTGRES_USER":     "worker",
+				"POSTGRES_PASSWORD": "worker",
+				"POSTGRES_DB":       "events",
+			},
+			// postgres restarts once after the init scripts
+			WaitingFor: wait.ForLog("database system is ready to accept connections").WithOccurrence(2).WithStartupTimeout(2 * time.Minute),
+		},
+		Started: true,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "starting postgres: %v\n", err)
+		return 1
+	}
+	defer func() {
+		if err := container.Terminate(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "terminating postgres: %v\n", err)
+		}
+	}()
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "postgres host: %v\n", err)
+		return 1
+	}
+	port, err := container.MappedPort(ctx, "5432/tcp")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "postgres port: %v\n", err)
+		return 1
+	}
+	config := postgres.DefaultConfig()
+	config.SSLMode = postgres.SSLDisable
+	integrationDB, err = postgres.NewDBClient(host, "worker", "worker", "events", port.Port(), config)
+	if err == nil {
+		err = integrationDB.Open()
+	}
+	if err == nil {
+		err = integrationDB.Migrate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opening postgres: %v\n", err)
+		return 1
+	}
+	defer integrationDB.Close()
+
+	return m.Run()
+}
+
+// newIntegrationRepository returns a repository on the migrated database without events.
+func newIntegrationRepository(t *testing.T) *EventRepository {
+	t.Helper()
+	if err := integrationDB.DB.Exec("TRUNCATE " + integrationDB.EventsTable()).Error; err != nil {
+		t.Fatalf("truncating events: %v", err)
+	}
+	return NewEventRepository(integrationDB, 0)
+}
+
+func TestIntegrationMigrate(t *testing.T) {
+	// the tables were created by TestMain, migrating again changes nothing
+	if err := integrationDB.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := integrationDB.AutoMigrate(&entity.Outbox{}, &entity.Attempts{}); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	pending, err := integrationDB.PendingMigrations()
+	if err != nil {
+		t.Fatalf("PendingMigrations: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("pending migrations %v after migrating", pending)
+	}
+	for _, table := range []string{integrationDB.EventsTable(), entity.Outbox{}.TableName(), entity.Attempts{}.TableName()} {
+		if !integrationDB.DB.Migrator().HasTable(table) {
+			t.Fatalf("table %s not created", table)
+		}
+	}
+}
+
+func TestIntegrationInsertUpsert(t *testing.T) {
+	repo := newIntegrationRepository(t)
+	ctx := context.Background()
+	date := time.Now().UTC().Truncate(time.Millisecond)
+
+	first := &domain.Events{ID: "1", Message: "hello", Date: date, Status: domain.StatusProcessing, Retry: 1}
+	if err := repo.Insert(ctx, first); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := repo.UpdateStatus(ctx, "1", domain.StatusFailed, "handler failed"); err != nil {
+		t.Fatalf("UpdateStatus: %v", err)
+	}
+	inserted, err := repo.GetByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+
+	// the redelivery overwrites the event keeping its creation time and its last error
+	redelivered := &domain.Events{ID: "1", Message: "hello again", Date: date, Status: domain.StatusProcessing, Retry: 2}
+	if err := repo.Insert(ctx, redelivered); err != nil {
+		t.Fatalf("Insert of the redelivered event: %v", err)
+	}
+	stored, err := repo.GetByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if stored.Message != "hello again" || stored.Retry != 2 || stored.Status != domain.StatusProcessing {
+		t.Fatalf("upserted event %+v, want the redelivered one", stored)
+	}
+	if !stored.CreatedAt.Equal(inserted.CreatedAt) || stored.LastError != "handler failed" {
+		t.Fatalf("upsert changed the creation time %v or the last error %q", stored.CreatedAt, stored.LastError)
+	}
+
+	batch := []*domain.Events{
+		{ID: "1", Message: "batched", Date: date, Status: domain.StatusReceived, Retry: 3},
+		{ID: "2", Message: "hello", Date: date, Status: domain.StatusProcessing},
+		{ID: "3", Message: "hello", Date: date, Status: domain.StatusProcessing},
+	}
+	if err := repo.InsertBatch(ctx, batch); err != nil {
+		t.Fatalf("InsertBatch: %v", err)
+	}
+	events, err := repo.List(ctx, domain.EventFilter{}, 0, 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("%d events stored, want 3", len(events))
+	}
+	// the batch keeps the status of a redelivered event
+	if stored, _ = repo.GetByID(ctx, "1"); stored.Message != "batched" || stored.Retry != 3 || stored.Status != domain.StatusProcessing {
+		t.Fatalf("batch upserted event %+v", stored)
+	}
+}
+
+func TestIntegrationListAndGetByID(t *testing.T) {
+	repo := newIntegrationRepository(t)
+	ctx := context.Background()
+	base := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	for i, status := range []string{domain.StatusProcessed, domain.StatusFailed, domain.StatusProcessed, domain.StatusProcessed} {
+		event := &domain.Events{ID: fmt.Sprint(i), Message: "hello", Date: base.Add(time.Duration(i) * time.Hour), Status: status}
+		if err := repo.Insert(ctx, event); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		filter        domain.EventFilter
+		limit, offset int
+		want          []string
+	}{
+		{name: "all, the most recent first", want: []string{"3", "2", "1", "0"}},
+		{name: "by status", filter: domain.EventFilter{Status: domain.StatusProcessed}, want: []string{"3", "2", "0"}},
+		{name: "by dates", filter: domain.EventFilter{From: base.Add(time.Hour), To: base.Add(2 * time.Hour)}, want: []string{"2", "1"}},
+		{name: "paginated", limit: 2, offset: 1, want: []string{"2", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := repo.List(ctx, tt.filter, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			ids := make([]string, 0, len(events))
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Fatalf("listed %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	event, err := repo.GetByID(ctx, "1")
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if event.Status != domain.StatusFailed || !event.Date.Equal(base.Add(time.Hour)) {
+		t.Fatalf("got event %+v", event)
+	}
+	if _, err := repo.GetByID(ctx, "missing"); !errors.Is(err, exceptions.ErrNotFound) {
+		t.Fatalf("GetByID of a missing event returned %v, want %v", err, exceptions.ErrNotFound)
+	}
+}
+
+func TestIntegrationDeleteOlderThan(t *testing.T) {
+	repo := newIntegrationRepository(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour)
+	events := []*domain.Events{
+		{ID: "old-processed", Message: "hello", Date: old, Status: domain.StatusProcessed},
+		{ID: "old-failed", Message: "hello", Date: old, Status: domain.StatusFailed},
+		{ID: "recent-processed", Message: "hello", Date: now, Status: domain.StatusProcessed},
+	}
+	if err := repo.InsertBatch(ctx, events); err != nil {
+		t.Fatalf("InsertBatch: %v", err)
+	}
+
+	deleted, err := repo.DeleteOlderThan(ctx, domain.StatusProcessed, now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteOlderThan: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("%d events deleted, want 1", deleted)
+	}
+	if _, err := repo.GetByID(ctx, "old-processed"); !errors.Is(err, exceptions.ErrNotFound) {
+		t.Fatalf("the old processed event wasn't deleted: %v", err)
+	}
+	for _, id := range []string{"old-failed", "recent-processed"} {
+		if _, err := repo.GetByID(ctx, id); err != nil {
+			t.Fatalf("event %s deleted: %v", id, err)
+		}
+	}
+}
+
+func TestIntegrationClaimOutbox(t *testing.T) {
+	repo := newIntegrationRepository(t)
+	ctx := context.Background()
+	if err := integrationDB.DB.Exec("TRUNCATE " + entity.Outbox{}.TableName()).Error; err != nil {
+		t.Fatalf("truncating outbox: %v", err)
+	}
+	for _, id := range []string{"1", "2"} {
+		if err := repo.AddOutbox(ctx, &domain.OutboxMessage{ID: id, Body: "hello"}); err != nil {
+			t.Fatalf("AddOutbox: %v", err)
+		}
+	}
+
+	claimed, err := repo.ClaimOutbox(ctx, 10, 0, time.Minute)
+	if err != nil || len(claimed) != 2 {
+		t.Fatalf("ClaimOutbox returned %d messages and %v, want both", len(claimed), err)
+	}
+	// the claimed messages are skipped by the next polls until their lease expires
+	if claimed, err = repo.ClaimOutbox(ctx, 10, 0, time.Minute); err != nil || len(claimed) != 0 {
+		t.Fatalf("ClaimOutbox returned %d messages and %v while they were claimed", len(claimed), err)
+	}
+	if err := repo.MarkPublished(ctx, "1"); err != nil {
+		t.Fatalf("MarkPublished: %v", err)
+	}
+	// a failed message is released to be published by the next poll
+	if err := repo.OutboxFailed(ctx, "2", "throttled"); err != nil {
+		t.Fatalf("OutboxFailed: %v", err)
+	}
+	claimed, err = repo.ClaimOutbox(ctx, 10, 0, time.Minute)
+	if err != nil || len(claimed) != 1 || claimed[0].ID != "2" || claimed[0].Attempts != 1 {
+		t.Fatalf("ClaimOutbox returned %v and %v, want the failed message", claimed, err)
+	}
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/core/domain/entity"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+	"service-worker-sqs-postgres/dataproviders/mapper"
+	"time"
+)
+
+// IOutboxRepository interface by repository of the outbox.
+type IOutboxRepository interface {
+	AddOutbox(ctx context.Context, msg *domain.OutboxMessage) error
+	ClaimOutbox(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]*domain.OutboxMessage, error)
+	MarkPublished(ctx context.Context, ID string) error
+	OutboxFailed(ctx context.Context, ID, lastError string) error
+}
+
+// outbox returns a statement on the table of the outbox.
+func (er *EventRepository) outbox(ctx context.Context) *gorm.DB {
+	return er.db.Conn(ctx).Table(entity.Outbox{}.TableName())
+}
+
+// AddOutbox records a message to publish, called with the repository of WithTransaction it's only published
+// if the transaction commits. A message with the ID of one already recorded is ignored, so it's published once.
+func (er *EventRepository) AddOutbox(ctx context.Context, msg *domain.OutboxMessage) error {
+	row := mapper.ToEntityOutbox(msg)
+	if row.CreatedAt.IsZero() {
+		row.CreatedAt = time.Now().UTC()
+	}
+	return classify(er.outbox(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error)
+}
+
+// ClaimOutbox returns the messages not published yet, the oldest first, locking them for lease so the
+// other relays skip them until they're published, failed or the lease expires. The messages that failed
+// maxAttempts times are left out, zero doesn't limit the attempts. It runs on the primary, a lagging
+// replica would return the messages just published again.
+func (er *EventRepository) ClaimOutbox(ctx context.Context, limit, maxAttempts int, lease time.Duration) ([]*domain.OutboxMessage, error) {
+	var rows []*entity.Outbox
+
+	now := time.Now().UTC()
+	err := er.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.Table(entity.Outbox{}.TableName()).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("published_at IS NULL").
+			Where("locked_until IS NULL OR locked_until < ?", now)
+		if maxAttempts > 0 {
+			query = query.Where("attempts < ?", maxAttempts)
+		}
+		if err := query.Order("created_at").Limit(limit).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		ids := make([]string, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+		return tx.Table(entity.Outbox{}.TableName()).Where("id IN ?", ids).Update("locked_until", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, exceptions.ErrInternalError
+	}
+
+	result := make([]*domain.OutboxMessage, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, mapper.ToDomainOutbox(row))
+	}
+	return result, nil
+}
+
+// MarkPublished records the moment the message was published.
+func (er *EventRepository) MarkPublished(ctx context.Context, ID string) error {
+	return classify(er.outbox(ctx).
+		Model(&entity.Outbox{}).
+		Where("id = ?", ID).
+		Update("published_at", time.Now().UTC()).Error)
+}
+
+// OutboxFailed counts a failed publication of the message and records its error, its lock is released so
+// the next poll publishes it again.
+func (er *EventRepository) OutboxFailed(ctx context.Context, ID, lastError string) error {
+	return classify(er.outbox(ctx).
+		Model(&entity.Outbox{}).
+		Where("id = ?", ID).
+		Updates(map[string]interface{}{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"last_error":   lastError,
+			"locked_until": nil,
+		}).Error)
+}
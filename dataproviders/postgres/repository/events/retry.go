@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// retryBaseDelay is the wait before the first retry of a transient error, it doubles on every retry.
+const retryBaseDelay = 100 * time.Millisecond
+
+// transientCodes are the postgres error codes worth retrying: serialization failures, deadlocks,
+// too many connections and a database starting or shutting down.
+var transientCodes = map[string]bool{
+	"40001": true,
+	"40P01": true,
+	"53300": true,
+	"57P01": true,
+	"57P02": true,
+	"57P03": true,
+}
+
+// mysqlTransientErrors are the mysql error numbers worth retrying: too many connections, a lock wait
+// timeout, a deadlock and a server gone away or lost.
+var mysqlTransientErrors = map[uint16]bool{
+	1040: true,
+	1205: true,
+	1213: true,
+	2006: true,
+	2013: true,
+}
+
+// isTransient reports whether err is a temporary failure of the database instead of a permanent one
+// like a constraint violation.
+func isTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// class 08 are connection exceptions
+		return transientCodes[pgErr.Code] || strings.HasPrefix(pgErr.Code, "08")
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return mysqlTransientErrors[myErr.Number]
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		pgconn.Timeout(err)
+}
+
+// withRetry runs op retrying it with backoff while it fails with a transient error, up to the max
+// retries of the repository. The last error is returned classified.
+func (er *EventRepository) withRetry(ctx context.Context, op func() error) error {
+	delay := retryBaseDelay
+	err := op()
+	for retry := 0; retry < er.maxRetries && err != nil && isTransient(err); retry++ {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return classify(err)
+		}
+		delay *= 2
+		err = op()
+	}
+	return classify(err)
+}
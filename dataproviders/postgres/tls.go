@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"net/url"
+	"os"
+)
+
+// The SSL modes of the connection, as the sslmode of postgres.
+const (
+	SSLDisable    = "disable"
+	SSLAllow      = "allow"
+	SSLPrefer     = "prefer"
+	SSLRequire    = "require"
+	SSLVerifyCA   = "verify-ca"
+	SSLVerifyFull = "verify-full"
+)
+
+// mysqlTLSConfig is the prefix of the names the TLS configurations of the mysql connections are
+// registered with, each host has its own since the configuration checks the server name.
+const mysqlTLSConfig = "service-worker"
+
+// validateTLS checks the SSL mode and that the certificate files exist.
+func (c Config) validateTLS() error {
+	switch c.SSLMode {
+	case SSLDisable, SSLAllow, SSLPrefer, SSLRequire, SSLVerifyCA, SSLVerifyFull:
+	default:
+		return fmt.Errorf("unknown ssl mode %q", c.SSLMode)
+	}
+	if (c.SSLCert == "") != (c.SSLKey == "") {
+		return fmt.Errorf("ssl cert and key must be set together")
+	}
+	for _, path := range []string{c.SSLRootCert, c.SSLCert, c.SSLKey} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("ssl certificate file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// postgresTLS returns the DSN parameters of the SSL configuration for postgres.
+func (c Config) postgresTLS() string {
+	params := fmt.Sprintf(" sslmode=%s", c.SSLMode)
+	if c.SSLRootCert != "" {
+		params += fmt.Sprintf(" sslrootcert=%s", c.SSLRootCert)
+	}
+	if c.SSLCert != "" {
+		params += fmt.Sprintf(" sslcert=%s sslkey=%s", c.SSLCert, c.SSLKey)
+	}
+	return params
+}
+
+// mysqlTLS returns the tls parameter of the mysql DSN for the SSL mode. The modes verifying the server
+// register a TLS configuration for the host with the certificates, mysql always checks the host name with them.
+func (c Config) mysqlTLS(host string) (string, error) {
+	switch c.SSLMode {
+	case SSLDisable:
+		return "false", nil
+	case SSLAllow, SSLPrefer:
+		return "preferred", nil
+	case SSLRequire:
+		if c.SSLCert == "" {
+			return "skip-verify", nil
+		}
+	}
+
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: c.SSLMode == SSLRequire}
+	if c.SSLRootCert != "" {
+		pem, err := os.ReadFile(c.SSLRootCert)
+		if err != nil {
+			return "", fmt.Errorf("error reading ssl root cert: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return "", fmt.Errorf("ssl root cert %s has no PEM certificates", c.SSLRootCert)
+		}
+	}
+	if c.SSLCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey)
+		if err != nil {
+			return "", fmt.Errorf("error loading ssl cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	name := mysqlTLSConfig + "-" + host
+	if err := mysql.RegisterTLSConfig(name, tlsConfig); err != nil {
+		return "", fmt.Errorf("error registering mysql tls config: %w", err)
+	}
+	return url.QueryEscape(name), nil
+}
@@ -1,29 +1,30 @@
 package processor
 
 import (
-	"go.uber.org/zap"
+	"context"
+	"runtime/debug"
 	"service-worker-sqs-postgres/core/domain"
 	"time"
 )
 
 // Processor represents a process.
 type Processor struct {
-	logger *zap.SugaredLogger
+	logger domain.Logger
 	source domain.Source
 }
 
 // New instance a new processor.
-func New(logger *zap.SugaredLogger, source domain.Source) (*Processor, error) {
+func New(logger domain.Logger, source domain.Source) (*Processor, error) {
 	return &Processor{
 		logger: logger,
 		source: source,
 	}, nil
 }
 
-// Start a processor execution.
-func (p *Processor) Start() {
-	p.logger.Info("Starting processor")
-	stream := p.source.Consume()
+// Start a processor execution, it runs until ctx is cancelled or the source is closed.
+func (p *Processor) Start(ctx context.Context) {
+	p.logger.Infof("Starting processor")
+	stream := p.source.Consume(ctx)
 	for event := range stream {
 		go p.handleEvent(event)
 	}
@@ -31,14 +32,19 @@ func (p *Processor) Start() {
 
 // handleEvent is the entry point to handle consolidate event.
 func (p *Processor) handleEvent(event *domain.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			event.Log.Errorf("Panic handling event %s: %v\n%s", event.ID, r, debug.Stack())
+		}
+	}()
 	if err := p.source.Processed(event); err != nil {
 		event.Log.Errorf("Error processing event: %v", err)
 	}
-	elapsed := time.Since(time.Now())
+	elapsed := time.Since(event.StartedAt)
 	event.Log.Infof("Step 5 - Event finished in %dms", elapsed.Milliseconds())
 }
 
-// Stop stops the Processor execution.
-func (p *Processor) Stop() error {
-	return p.source.Close()
+// Stop stops the Processor execution, waiting until ctx is done for the in-flight events.
+func (p *Processor) Stop(ctx context.Context) error {
+	return p.source.Close(ctx)
 }
@@ -0,0 +1,31 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+)
+
+// SQSProducer publishes events to SQS.
+type SQSProducer struct {
+	sqs awssqs.Sender
+}
+
+// New return a producer instance publishing to SQS.
+func New(sqsClient awssqs.Sender) *SQSProducer {
+	return &SQSProducer{
+		sqs: sqsClient,
+	}
+}
+
+// Publish sends the event as a JSON message and returns the SQS message ID.
+func (p *SQSProducer) Publish(ctx context.Context, events *domain.Events, attrs map[string]string) (string, error) {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling event: %w", err)
+	}
+
+	return p.sqs.SendMessage(ctx, string(body), attrs)
+}
@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	goredis "github.com/redis/go-redis/v9"
+	"time"
+)
+
+// keyPrefix namespaces the keys of the message IDs.
+const keyPrefix = "sqs:seen:"
+
+// Deduper remembers the received message IDs in Redis for a TTL, it implements consumer.Deduper.
+type Deduper struct {
+	client goredis.UniversalClient
+	ttl    time.Duration
+}
+
+// NewDeduper instances of a Deduper connected to the Redis at addr, the IDs expire after ttl.
+func NewDeduper(addr, password string, ttl time.Duration) (*Deduper, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("redis address is required to deduplicate the messages")
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("dedup ttl must be positive, got %v", ttl)
+	}
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     addr,
+		Password: password,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("error connecting to redis %s: %w", addr, err)
+	}
+	return &Deduper{client: client, ttl: ttl}, nil
+}
+
+// Seen sets the key of id when absent, it reports true when it was already set.
+func (d *Deduper) Seen(ctx context.Context, id string) (bool, error) {
+	set, err := d.client.SetNX(ctx, keyPrefix+id, 1, d.ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("error setting the key of message %s: %w", id, err)
+	}
+	return !set, nil
+}
+
+// Forget deletes the key of id.
+func (d *Deduper) Forget(ctx context.Context, id string) error {
+	if err := d.client.Del(ctx, keyPrefix+id).Err(); err != nil {
+		return fmt.Errorf("error deleting the key of message %s: %w", id, err)
+	}
+	return nil
+}
+
+// Close closes the connection to Redis.
+func (d *Deduper) Close() error {
+	return d.client.Close()
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"service-worker-sqs-postgres/entrypoints/controllers/events"
+	"service-worker-sqs-postgres/entrypoints/controllers/health"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -22,7 +23,8 @@ type Server struct {
 }
 
 // NewServer creates an instance of Http Server.
-func NewServer(port int, ec *events.EventController) *Server {
+// The metrics handler is mounted on /metrics when it isn't nil.
+func NewServer(port int, ec *events.EventController, hc *health.HealthController, metrics http.Handler) *Server {
 	e := echo.New()
 
 	// middleware
@@ -31,10 +33,20 @@ func NewServer(port int, ec *events.EventController) *Server {
 
 	server := &Server{server: e, port: port}
 
+	// health
+	e.GET("/healthz", hc.Liveness)
+	e.GET("/ready", hc.Readiness)
+
+	// metrics
+	if metrics != nil {
+		e.GET("/metrics", echo.WrapHandler(metrics))
+	}
+
 	// prefix
 	path := e.Group(rootPrefix)
 
 	// events
+	path.GET("/sqs", ec.List)
 	path.GET("/sqs/:id", ec.GetID)
 
 	return server
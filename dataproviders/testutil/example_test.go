@@ -0,0 +1,78 @@
+package testutil_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/dataproviders/testutil"
+)
+
+func ExampleFakeSQS() {
+	ctx := context.Background()
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue(`{"order_id":"A-17"}`, map[string]string{"correlation-id": "c-1"})
+
+	messages, _ := fake.GetMessages(ctx)
+	msg := messages[0]
+	fmt.Println(aws.StringValue(msg.Body), aws.StringValue(msg.MessageAttributes["correlation-id"].StringValue))
+	fmt.Println("in-flight:", fake.InFlight())
+
+	if err := fake.DeleteMessage(ctx, msg); err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("in-flight:", fake.InFlight(), "deleted:", len(fake.Deleted()))
+	// Output:
+	// {"order_id":"A-17"} c-1
+	// in-flight: 1
+	// in-flight: 0 deleted: 1
+}
+
+func ExampleFakeSQS_FailNext() {
+	ctx := context.Background()
+	fake := testutil.NewFakeSQS()
+	fake.Enqueue("hello", nil)
+	fake.FailNext(testutil.OpReceive, errors.New("throttled"), 1)
+
+	_, err := fake.GetMessages(ctx)
+	fmt.Println(err)
+	messages, _ := fake.GetMessages(ctx)
+	fmt.Println(len(messages), "message after", fake.Receives(), "receives")
+	// Output:
+	// throttled
+	// 1 message after 2 receives
+}
+
+func ExampleMemoryStore() {
+	ctx := context.Background()
+	store := testutil.NewMemoryStore()
+
+	if err := store.Insert(ctx, &domain.Events{ID: "1", Message: "hello", Status: domain.StatusReceived}); err != nil {
+		fmt.Println(err)
+	}
+	if err := store.MarkProcessed(ctx, "1"); err != nil {
+		fmt.Println(err)
+	}
+	event, _ := store.GetByID(ctx, "1")
+	fmt.Println(event.Status, store.Len())
+
+	processed, _ := store.InsertIfNotProcessed(ctx, &domain.Events{ID: "1", Message: "hello again"})
+	fmt.Println("already processed:", processed)
+	// Output:
+	// processed 1
+	// already processed: true
+}
+
+func ExampleMemoryStore_FailInserts() {
+	ctx := context.Background()
+	store := testutil.NewMemoryStore()
+	store.FailInserts(errors.New("connection refused"), 1)
+
+	fmt.Println(store.Insert(ctx, &domain.Events{ID: "1"}))
+	fmt.Println(store.Insert(ctx, &domain.Events{ID: "1"}), store.Len())
+	// Output:
+	// connection refused
+	// <nil> 1
+}
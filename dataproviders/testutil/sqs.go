@@ -0,0 +1,272 @@
+package testutil
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"service-worker-sqs-postgres/dataproviders/awssqs"
+	"service-worker-sqs-postgres/dataproviders/utils"
+)
+
+// Operation is a call of the FakeSQS that can be made to fail with FailNext.
+type Operation string
+
+const (
+	OpReceive    Operation = "receive"
+	OpDelete     Operation = "delete"
+	OpForward    Operation = "forward"
+	OpVisibility Operation = "visibility"
+)
+
+// failure is an error returned by the next calls of an operation.
+type failure struct {
+	err       error
+	remaining int
+}
+
+// FakeSQS is an in-memory awssqs.Client that delivers the enqueued messages and records the deletes.
+// A received message stays in-flight until it's deleted, Redeliver or a zero visibility change puts it
+// back in the queue with its receive count incremented as SQS does.
+type FakeSQS struct {
+	mu        sync.Mutex
+	messages  []*sqs.Message
+	inFlight  map[string]*sqs.Message
+	deleted   []*sqs.Message
+	forwarded []*sqs.Message
+	failures  map[Operation]*failure
+	receives  int
+}
+
+// NewFakeSQS creates a fake client that delivers the given messages.
+func NewFakeSQS(messages ...*sqs.Message) *FakeSQS {
+	return &FakeSQS{
+		messages: messages,
+		inFlight: make(map[string]*sqs.Message),
+		failures: make(map[Operation]*failure),
+	}
+}
+
+// URL returns the URL of the fake queue.
+func (f *FakeSQS) URL() string {
+	return "https://sqs.local/000000000000/fake"
+}
+
+// Enqueue adds a message with body to the queue and returns it, it gets a new ID and receipt handle.
+func (f *FakeSQS) Enqueue(body string, attrs map[string]string) *sqs.Message {
+	msg := &sqs.Message{
+		MessageId:     aws.String(utils.NewID()),
+		ReceiptHandle: aws.String(utils.NewID()),
+		Body:          aws.String(body),
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameSentTimestamp: aws.String(strconv.FormatInt(time.Now().UnixMilli(), 10)),
+		},
+	}
+	if len(attrs) > 0 {
+		msg.MessageAttributes = make(map[string]*sqs.MessageAttributeValue, len(attrs))
+		for name, value := range attrs {
+			msg.MessageAttributes[name] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = append(f.messages, msg)
+	return msg
+}
+
+// FailNext makes the next n calls of op return err.
+func (f *FakeSQS) FailNext(op Operation, err error, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures[op] = &failure{err: err, remaining: n}
+}
+
+// fail returns the error of the failure of op, if any. The lock must be held.
+func (f *FakeSQS) fail(op Operation) error {
+	fl, ok := f.failures[op]
+	if !ok {
+		return nil
+	}
+	fl.remaining--
+	if fl.remaining <= 0 {
+		delete(f.failures, op)
+	}
+	return fl.err
+}
+
+// GetMessages returns the pending messages, they're in-flight until they're deleted or redelivered.
+func (f *FakeSQS) GetMessages(_ context.Context) ([]*sqs.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.receives++
+	if err := f.fail(OpReceive); err != nil {
+		return nil, err
+	}
+	messages := f.messages
+	f.messages = nil
+	for _, msg := range messages {
+		received(msg)
+		f.inFlight[aws.StringValue(msg.MessageId)] = msg
+	}
+	return messages, nil
+}
+
+// received increments the receive count attribute of msg.
+func received(msg *sqs.Message) {
+	if msg.Attributes == nil {
+		msg.Attributes = make(map[string]*string)
+	}
+	count, _ := strconv.Atoi(aws.StringValue(msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]))
+	msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount] = aws.String(strconv.Itoa(count + 1))
+}
+
+// Redeliver puts every in-flight message back in the queue, as if their visibility timeout expired.
+func (f *FakeSQS) Redeliver() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, msg := range f.inFlight {
+		delete(f.inFlight, id)
+		f.messages = append(f.messages, msg)
+	}
+}
+
+// DeleteMessage records the deleted message.
+func (f *FakeSQS) DeleteMessage(_ context.Context, msg *sqs.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail(OpDelete); err != nil {
+		return err
+	}
+	delete(f.inFlight, aws.StringValue(msg.MessageId))
+	f.deleted = append(f.deleted, msg)
+	return nil
+}
+
+// DeleteMessageBatch records the deleted messages.
+func (f *FakeSQS) DeleteMessageBatch(_ context.Context, messages []*sqs.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail(OpDelete); err != nil {
+		return err
+	}
+	for _, msg := range messages {
+		delete(f.inFlight, aws.StringValue(msg.MessageId))
+	}
+	f.deleted = append(f.deleted, messages...)
+	return nil
+}
+
+// Forward records the forwarded message.
+func (f *FakeSQS) Forward(_ context.Context, msg *sqs.Message, _ map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail(OpForward); err != nil {
+		return err
+	}
+	f.forwarded = append(f.forwarded, msg)
+	return nil
+}
+
+// Requeue records the message as forwarded and enqueues a copy of it with a new ID and receipt handle,
+// the delay isn't applied so the copy is delivered by the next receive.
+func (f *FakeSQS) Requeue(_ context.Context, msg *sqs.Message, attrs map[string]string, _ int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail(OpForward); err != nil {
+		return err
+	}
+	f.forwarded = append(f.forwarded, msg)
+	copied := &sqs.Message{
+		MessageId:         aws.String(utils.NewID()),
+		ReceiptHandle:     aws.String(utils.NewID()),
+		Body:              msg.Body,
+		Attributes:        map[string]*string{},
+		MessageAttributes: make(map[string]*sqs.MessageAttributeValue, len(msg.MessageAttributes)+len(attrs)),
+	}
+	for name, value := range msg.Attributes {
+		if name != sqs.MessageSystemAttributeNameApproximateReceiveCount {
+			copied.Attributes[name] = value
+		}
+	}
+	for name, value := range msg.MessageAttributes {
+		copied.MessageAttributes[name] = value
+	}
+	for name, value := range attrs {
+		copied.MessageAttributes[name] = &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(value)}
+	}
+	f.messages = append(f.messages, copied)
+	return nil
+}
+
+// ChangeMessageVisibility puts the message back in the queue right away when seconds is zero, the
+// fake has no visibility timeout so any other value leaves it in-flight until Redeliver.
+func (f *FakeSQS) ChangeMessageVisibility(_ context.Context, msg *sqs.Message, seconds int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.fail(OpVisibility); err != nil {
+		return err
+	}
+	id := aws.StringValue(msg.MessageId)
+	if _, ok := f.inFlight[id]; ok && seconds == 0 {
+		delete(f.inFlight, id)
+		f.messages = append(f.messages, msg)
+	}
+	return nil
+}
+
+// Ping always succeeds.
+func (f *FakeSQS) Ping(_ context.Context) error {
+	return nil
+}
+
+// GetQueueAttributes returns the pending messages as visible and the in-flight ones as not visible.
+func (f *FakeSQS) GetQueueAttributes(_ context.Context) (awssqs.QueueAttributes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return awssqs.QueueAttributes{Visible: int64(len(f.messages)), NotVisible: int64(len(f.inFlight))}, nil
+}
+
+// Deleted returns the messages deleted so far.
+func (f *FakeSQS) Deleted() []*sqs.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*sqs.Message(nil), f.deleted...)
+}
+
+// Forwarded returns the messages forwarded so far.
+func (f *FakeSQS) Forwarded() []*sqs.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]*sqs.Message(nil), f.forwarded...)
+}
+
+// Receives returns the number of calls of GetMessages, the failed ones included.
+func (f *FakeSQS) Receives() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.receives
+}
+
+// InFlight returns the number of messages received and not deleted yet.
+func (f *FakeSQS) InFlight() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.inFlight)
+}
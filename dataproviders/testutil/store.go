@@ -0,0 +1,338 @@
+package testutil
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+	repository "service-worker-sqs-postgres/dataproviders/postgres/repository/events"
+)
+
+// MemoryStore is an in-memory repository.IEventRepository and repository.IOutboxRepository keyed by event ID.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events map[string]*domain.Events
+	outbox []*domain.OutboxMessage
+	// lockedUntil are the leases of the claimed outbox messages keyed by ID.
+	lockedUntil map[string]time.Time
+	// attempts are the histories of the attempts keyed by event ID.
+	attempts map[string][]*domain.Attempt
+	// insertFailure makes the next inserts fail, it's set by FailInserts.
+	insertFailure *failure
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		events:      make(map[string]*domain.Events),
+		lockedUntil: make(map[string]time.Time),
+		attempts:    make(map[string][]*domain.Attempt),
+	}
+}
+
+// GetID return the event by ID.
+func (m *MemoryStore) GetID(ID string) (*domain.Events, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.events[ID]
+	if !ok {
+		return nil, exceptions.ErrNotFound
+	}
+	copied := *event
+	return &copied, nil
+}
+
+// FailInserts makes the next n inserts return err, including the ones made by InsertBatch and InsertIfNotProcessed.
+func (m *MemoryStore) FailInserts(err error, n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.insertFailure = &failure{err: err, remaining: n}
+}
+
+// Insert upserts the event like the postgres repository does.
+func (m *MemoryStore) Insert(_ context.Context, events *domain.Events) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fl := m.insertFailure; fl != nil {
+		fl.remaining--
+		if fl.remaining <= 0 {
+			m.insertFailure = nil
+		}
+		return fl.err
+	}
+	now := time.Now().UTC()
+	copied := *events
+	if stored, ok := m.events[events.ID]; ok {
+		copied.CreatedAt = stored.CreatedAt
+		copied.LastError = stored.LastError
+		copied.ProcessedAt = stored.ProcessedAt
+	} else {
+		copied.CreatedAt = now
+	}
+	copied.UpdatedAt = now
+	m.events[events.ID] = &copied
+	return nil
+}
+
+// InsertBatch records the events one by one, a redelivered event keeps its status like in the postgres repository.
+func (m *MemoryStore) InsertBatch(ctx context.Context, events []*domain.Events) error {
+	for _, event := range events {
+		copied := *event
+		m.mu.Lock()
+		if stored, ok := m.events[event.ID]; ok {
+			copied.Status = stored.Status
+		}
+		m.mu.Unlock()
+		if err := m.Insert(ctx, &copied); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertIfNotProcessed records an event unless it was already processed, which is reported as true.
+func (m *MemoryStore) InsertIfNotProcessed(ctx context.Context, events *domain.Events) (bool, error) {
+	m.mu.Lock()
+	stored, ok := m.events[events.ID]
+	processed := ok && stored.Status == domain.StatusProcessed
+	m.mu.Unlock()
+
+	if processed {
+		return true, nil
+	}
+	return false, m.Insert(ctx, events)
+}
+
+// MarkProcessed records the moment the event was processed.
+func (m *MemoryStore) MarkProcessed(_ context.Context, ID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.events[ID]
+	if !ok {
+		return exceptions.ErrNotFound
+	}
+	now := time.Now().UTC()
+	event.Status = domain.StatusProcessed
+	event.ProcessedAt = &now
+	event.UpdatedAt = now
+	return nil
+}
+
+// UpdateStatus sets the status of the event, lastError is only recorded when it isn't empty.
+func (m *MemoryStore) UpdateStatus(_ context.Context, ID, status, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.events[ID]
+	if !ok {
+		return exceptions.ErrNotFound
+	}
+	event.Status = status
+	if lastError != "" {
+		event.LastError = lastError
+	}
+	event.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// QueryFailed returns the events with an error, the most retried first.
+func (m *MemoryStore) QueryFailed(_ context.Context, limit int) ([]*domain.Events, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var failed []*domain.Events
+	for _, event := range m.events {
+		if event.LastError != "" {
+			copied := *event
+			failed = append(failed, &copied)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool {
+		if failed[i].Retry != failed[j].Retry {
+			return failed[i].Retry > failed[j].Retry
+		}
+		return failed[i].UpdatedAt.After(failed[j].UpdatedAt)
+	})
+	if limit > 0 && len(failed) > limit {
+		failed = failed[:limit]
+	}
+	return failed, nil
+}
+
+// GetByID return the event by ID.
+func (m *MemoryStore) GetByID(_ context.Context, ID string) (*domain.Events, error) {
+	return m.GetID(ID)
+}
+
+// List returns the events matching filter, the most recent first.
+func (m *MemoryStore) List(_ context.Context, filter domain.EventFilter, limit, offset int) ([]*domain.Events, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []*domain.Events
+	for _, event := range m.events {
+		if filter.Status != "" && event.Status != filter.Status {
+			continue
+		}
+		if !filter.From.IsZero() && event.Date.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && event.Date.After(filter.To) {
+			continue
+		}
+		copied := *event
+		events = append(events, &copied)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Date.After(events[j].Date)
+	})
+	if offset >= len(events) {
+		return nil, nil
+	}
+	events = events[offset:]
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+// DeleteOlderThan removes the events with status dated before cutoff.
+func (m *MemoryStore) DeleteOlderThan(_ context.Context, status string, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, event := range m.events {
+		if event.Status == status && event.Date.Before(cutoff) {
+			delete(m.events, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Len returns the number of stored events.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.events)
+}
+
+// Ping always succeeds.
+func (m *MemoryStore) Ping(_ context.Context) error {
+	return nil
+}
+
+// WithTransaction runs fn with the store itself, the writes of a failed fn aren't rolled back.
+func (m *MemoryStore) WithTransaction(_ context.Context, fn func(tx repository.Transaction) error) error {
+	return fn(m)
+}
+
+// AddOutbox records a message to publish, a message with the ID of one already recorded is ignored.
+func (m *MemoryStore) AddOutbox(_ context.Context, msg *domain.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, stored := range m.outbox {
+		if stored.ID == msg.ID {
+			return nil
+		}
+	}
+	copied := *msg
+	if copied.CreatedAt.IsZero() {
+		copied.CreatedAt = time.Now().UTC()
+	}
+	m.outbox = append(m.outbox, &copied)
+	return nil
+}
+
+// ClaimOutbox returns the messages not published yet in the order they were added, the messages claimed
+// are skipped until they're published, failed or their lease expires.
+func (m *MemoryStore) ClaimOutbox(_ context.Context, limit, maxAttempts int, lease time.Duration) ([]*domain.OutboxMessage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var pending []*domain.OutboxMessage
+	for _, msg := range m.outbox {
+		if msg.PublishedAt != nil || (maxAttempts > 0 && msg.Attempts >= maxAttempts) || now.Before(m.lockedUntil[msg.ID]) {
+			continue
+		}
+		m.lockedUntil[msg.ID] = now.Add(lease)
+		copied := *msg
+		pending = append(pending, &copied)
+		if len(pending) == limit {
+			break
+		}
+	}
+	return pending, nil
+}
+
+// MarkPublished records the moment the message was published.
+func (m *MemoryStore) MarkPublished(_ context.Context, ID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.outbox {
+		if msg.ID == ID {
+			now := time.Now().UTC()
+			msg.PublishedAt = &now
+			return nil
+		}
+	}
+	return exceptions.ErrNotFound
+}
+
+// OutboxFailed counts a failed publication of the message and records its error, its claim is released.
+func (m *MemoryStore) OutboxFailed(_ context.Context, ID, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range m.outbox {
+		if msg.ID == ID {
+			msg.Attempts++
+			msg.LastError = lastError
+			delete(m.lockedUntil, ID)
+			return nil
+		}
+	}
+	return exceptions.ErrNotFound
+}
+
+// AddAttempt appends an attempt to the history of its event keeping the last keep ones, zero keeps them all.
+func (m *MemoryStore) AddAttempt(_ context.Context, attempt *domain.Attempt, keep int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	copied := *attempt
+	if copied.At.IsZero() {
+		copied.At = time.Now().UTC()
+	}
+	history := append(m.attempts[attempt.EventID], &copied)
+	if keep > 0 && len(history) > keep {
+		history = history[len(history)-keep:]
+	}
+	m.attempts[attempt.EventID] = history
+	return nil
+}
+
+// Attempts returns the history of the attempts of an event, the oldest first.
+func (m *MemoryStore) Attempts(_ context.Context, eventID string) ([]*domain.Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history := make([]*domain.Attempt, 0, len(m.attempts[eventID]))
+	for _, attempt := range m.attempts[eventID] {
+		copied := *attempt
+		history = append(history, &copied)
+	}
+	return history, nil
+}
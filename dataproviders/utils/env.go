@@ -6,6 +6,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"os"
 	"strconv"
+	"time"
 )
 
 func GetString(name string) (string, error) {
@@ -16,6 +17,14 @@ func GetString(name string) (string, error) {
 	return v, nil
 }
 
+func GetStringOrDefault(name, def string) string {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	return v
+}
+
 func GetInt(name string) (int, error) {
 	v, ok := os.LookupEnv(name)
 	if !ok {
@@ -28,6 +37,25 @@ func GetInt(name string) (int, error) {
 	return intV, nil
 }
 
+func GetIntOrDefault(name string, def int) (int, error) {
+	if _, ok := os.LookupEnv(name); !ok {
+		return def, nil
+	}
+	return GetInt(name)
+}
+
+func GetBoolOrDefault(name string, def bool) (bool, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return def, nil
+	}
+	boolV, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("env var %s must be a boolean", name)
+	}
+	return boolV, nil
+}
+
 func GetParam(c echo.Context, name string) (string, error) {
 	strParam := c.Param(name)
 	if strParam == "" {
@@ -35,3 +63,27 @@ func GetParam(c echo.Context, name string) (string, error) {
 	}
 	return strParam, nil
 }
+
+func GetQueryIntOrDefault(c echo.Context, name string, def int) (int, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return def, nil
+	}
+	intV, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("query param '%s' must be a number", name)
+	}
+	return intV, nil
+}
+
+func GetQueryTime(c echo.Context, name string) (time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	timeV, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("query param '%s' must be a RFC3339 date", name)
+	}
+	return timeV, nil
+}
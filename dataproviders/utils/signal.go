@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ShutdownSignals are the signals that trigger a graceful shutdown.
+var ShutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGQUIT, syscall.SIGABRT, syscall.SIGTERM}
+
+// WaitForSignal blocks until a shutdown signal is received and returns it, nil when ctx is done first.
+func WaitForSignal(ctx context.Context) os.Signal {
+	sigQuit := make(chan os.Signal, 1)
+	signal.Notify(sigQuit, ShutdownSignals...)
+	defer signal.Stop(sigQuit)
+
+	select {
+	case sig := <-sigQuit:
+		return sig
+	case <-ctx.Done():
+		return nil
+	}
+}
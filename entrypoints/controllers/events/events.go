@@ -1,13 +1,21 @@
 package events
 
 import (
+	"fmt"
 	"github.com/labstack/echo/v4"
 	"net/http"
+	"service-worker-sqs-postgres/core/domain"
 	"service-worker-sqs-postgres/core/domain/exceptions"
 	cases "service-worker-sqs-postgres/core/usecases/events"
 	env "service-worker-sqs-postgres/dataproviders/utils"
 )
 
+// defaultListLimit and maxListLimit bound the page size of List.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 500
+)
+
 // EventController encapsulates all the data necessary for the implementation of the EventsService.
 type EventController struct {
 	eventUseCases cases.IEventCaseUses
@@ -32,3 +40,33 @@ func (ec *EventController) GetID(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, events)
 }
+
+// List return the events matching the query params status, from and to, paginated with limit and offset [eventsService.List].
+func (ec *EventController) List(c echo.Context) error {
+	from, err := env.GetQueryTime(c, "from")
+	if err != nil {
+		return exceptions.NewError(http.StatusBadRequest, err)
+	}
+	to, err := env.GetQueryTime(c, "to")
+	if err != nil {
+		return exceptions.NewError(http.StatusBadRequest, err)
+	}
+	limit, err := env.GetQueryIntOrDefault(c, "limit", defaultListLimit)
+	if err != nil {
+		return exceptions.NewError(http.StatusBadRequest, err)
+	}
+	offset, err := env.GetQueryIntOrDefault(c, "offset", 0)
+	if err != nil {
+		return exceptions.NewError(http.StatusBadRequest, err)
+	}
+	if limit < 1 || limit > maxListLimit || offset < 0 {
+		return exceptions.NewError(http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d and offset must not be negative", maxListLimit))
+	}
+
+	filter := domain.EventFilter{Status: c.QueryParam("status"), From: from, To: to}
+	events, err := ec.eventUseCases.List(c.Request().Context(), filter, limit, offset)
+	if err != nil {
+		return exceptions.HandleServiceError(err)
+	}
+	return c.JSON(http.StatusOK, events)
+}
@@ -0,0 +1,36 @@
+package health
+
+import (
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"service-worker-sqs-postgres/core/domain"
+	"service-worker-sqs-postgres/core/domain/exceptions"
+)
+
+// HealthController exposes the liveness and readiness of the consumer.
+type HealthController struct {
+	source domain.Source
+}
+
+// NewHealthController instantiate a new health controller.
+func NewHealthController(source domain.Source) *HealthController {
+	return &HealthController{
+		source: source,
+	}
+}
+
+// Liveness reports whether the consumer is still polling.
+func (hc *HealthController) Liveness(c echo.Context) error {
+	if err := hc.source.Liveness(); err != nil {
+		return exceptions.NewError(http.StatusServiceUnavailable, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readiness reports whether SQS and the database are reachable.
+func (hc *HealthController) Readiness(c echo.Context) error {
+	if err := hc.source.Health(c.Request().Context()); err != nil {
+		return exceptions.NewError(http.StatusServiceUnavailable, err)
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}